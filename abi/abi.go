@@ -0,0 +1,39 @@
+// Package abi 内置 SoDiamond、uniswap、erc20 等合约的 abi json 文件
+package abi
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// FS 编译时内置的 abi json 文件
+//
+//go:embed *.json
+var FS embed.FS
+
+// WithOverride 优先读取 dir 目录下的 abi 文件，不存在时使用内置文件
+// dir 为空时直接返回内置文件
+func WithOverride(dir string) fs.FS {
+	if dir == "" {
+		return FS
+	}
+	return overrideFS{override: os.DirFS(dir), base: FS}
+}
+
+type overrideFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o overrideFS) Open(name string) (fs.File, error) {
+	file, err := o.override.Open(name)
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.base.Open(name)
+}
@@ -2,34 +2,343 @@ package connpool
 
 import (
 	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+const (
+	// evmPingTimeout eth_chainId 检查连接的超时时间
+	evmPingTimeout = 5 * time.Second
+
+	// endpointCooldown rpc 地址出错后暂停使用的时间，连续出错时翻倍
+	endpointCooldown    = time.Second
+	maxEndpointCooldown = time.Minute
+
+	// latencySmoothing 耗时滑动平均中最近一次调用的权重
+	latencySmoothing = 0.2
+
+	// rpcLimitExceeded 部分 rpc 服务商限流时返回的 json-rpc 错误码
+	rpcLimitExceeded = -32005
+)
+
+// Endpoint 一条链的一个 rpc 地址
+type Endpoint struct {
+	Url      string
+	Priority int // 越小越优先，优先级相同的地址按 Weight 随机分配
+	Weight   int // 为 0 时按 1 处理
+}
+
+// EndpointStats 单个 rpc 地址的调用统计
+type EndpointStats struct {
+	Endpoint
+	Calls          uint64
+	Errors         uint64        // 连接错误、限流、5xx 等导致切换地址的错误
+	Latency        time.Duration // 调用耗时的滑动平均
+	LastError      string
+	Healthy        bool
+	UnhealthyUntil time.Time
+	Pool           Stats // 该地址连接池的状态
+}
+
+// ErrorRate 出错调用的比例
+func (s EndpointStats) ErrorRate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Calls)
+}
+
+// EvmConn 一个 rpc 连接及其 ethclient 封装，封装在建立连接时创建，之后重复使用
+type EvmConn struct {
+	Rpc *rpc.Client
+	Eth *ethclient.Client
+}
+
+func (c *EvmConn) Close() {
+	c.Rpc.Close()
+}
+
+// endpoint 一个 rpc 地址及其连接池
+type endpoint struct {
+	Endpoint
+	pool *Pool[*EvmConn]
+
+	l         sync.Mutex
+	calls     uint64
+	errors    uint64
+	failures  int // 连续出错次数
+	latency   time.Duration
+	lastErr   error
+	downUntil time.Time
+}
+
+// EvmOptions evm rpc 连接池的参数
+type EvmOptions struct {
+	MaxConnect int         // 每个地址的最大连接数
+	RateLimit  float64     // 整个连接池每秒最多调用次数，为 0 时不限流
+	RateBurst  int         // 限流时允许的突发调用次数，为 0 时按 1 处理
+	Retry      RetryPolicy // Read 的重试策略
+}
+
+// EvmConnectPoll evm rpc 连接池，一条链可以配置多个 rpc 地址
+// 调用按优先级及权重选择可用的地址，连接错误、限流或 5xx 时切换到下一个地址
+// 配置 RateLimit 时所有地址共用一个令牌桶，每次调用一个地址消耗一个令牌
 type EvmConnectPoll struct {
-	*ConnectPoll
+	endpoints []*endpoint
+	limiter   *tokenBucket
+	retry     RetryPolicy
+
+	randLock sync.Mutex
+	rand     *rand.Rand
+}
+
+// NewEvmConnectPoll 初始化 evm rpc 连接池，支持 http 及 websocket 地址
+// 空闲较久的连接取出时使用 eth_chainId 检查，连接错误的连接会被关闭并重新建立
+// 建立连接受触发建立连接的调用的 ctx 限制
+func NewEvmConnectPoll(endpoints []Endpoint, opts EvmOptions) *EvmConnectPoll {
+	e := &EvmConnectPoll{
+		limiter: newTokenBucket(opts.RateLimit, opts.RateBurst),
+		retry:   opts.Retry.withDefaults(),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, item := range endpoints {
+		rawUrl := item.Url
+		if item.Weight <= 0 {
+			item.Weight = 1
+		}
+		e.endpoints = append(e.endpoints, &endpoint{
+			Endpoint: item,
+			pool: NewPool(int32(opts.MaxConnect), func(ctx context.Context) (*EvmConn, error) {
+				client, err := rpc.DialContext(ctx, rawUrl)
+				if err != nil {
+					return nil, err
+				}
+				return &EvmConn{Rpc: client, Eth: ethclient.NewClient(client)}, nil
+			}, Options[*EvmConn]{
+				Ping:             pingEvm,
+				IsTransportError: isEvmTransportError,
+			}),
+		})
+	}
+	return e
 }
 
-// NewEvmConnectPoll 初始化 evm websocket 连接池
-func NewEvmConnectPoll(ctx context.Context, rawUrl string, maxConnect int) *EvmConnectPoll {
-	return &EvmConnectPoll{
-		ConnectPoll: NewConnectPoll(int32(maxConnect), func() Closeable {
-			client, err := rpc.DialContext(ctx, rawUrl)
-			if err != nil {
-				return nil
+// Call 取出连接调用 f，连接数达到上限或被限流时排队等待，ctx 取消后不再等待
+// f 返回连接错误、限流或 5xx 时换下一个地址重新调用 f，其他错误直接返回
+// 所有地址都失败时不再重试；切换地址时 f 会再次执行，发送交易时 f 只能发送已签名的交易，不能在 f 中分配 nonce 或签名
+func (e *EvmConnectPoll) Call(ctx context.Context, f func(*ethclient.Client, *rpc.Client) error) error {
+	err := errors.New("no rpc endpoint")
+	for _, ep := range e.order() {
+		if err = e.limiter.wait(ctx); err != nil {
+			return err
+		}
+		err = ep.call(ctx, f)
+		if err == nil || ctx.Err() != nil || !shouldFailover(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Read 与 Call 相同，所有地址都失败时按 RetryPolicy 指数退避后重试
+// f 只能包含 CallContract、EstimateGas、TransactionReceipt 等幂等的读请求，或者发送同一笔已签名的交易，重试时会再次调用 f
+func (e *EvmConnectPoll) Read(ctx context.Context, f func(*ethclient.Client, *rpc.Client) error) error {
+	var err error
+	for attempt := 0; attempt < e.retry.Attempts; attempt++ {
+		if attempt > 0 {
+			e.randLock.Lock()
+			backoff := e.retry.backoff(attempt, e.rand)
+			e.randLock.Unlock()
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
 			}
-			return client
-		}),
+		}
+		err = e.Call(ctx, f)
+		if err == nil || ctx.Err() != nil || !shouldFailover(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// Close 关闭所有地址的连接池，等待进行中的调用结束
+func (e *EvmConnectPoll) Close() {
+	_ = e.Shutdown(context.Background())
+}
+
+// Shutdown 关闭所有地址的连接池，拒绝新的调用，ctx 结束时不再等待进行中的调用
+func (e *EvmConnectPoll) Shutdown(ctx context.Context) error {
+	var err error
+	for _, ep := range e.endpoints {
+		if shutdownErr := ep.pool.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// EndpointStats 返回每个 rpc 地址的调用统计
+func (e *EvmConnectPoll) EndpointStats() []EndpointStats {
+	now := time.Now()
+	stats := make([]EndpointStats, len(e.endpoints))
+	for i, ep := range e.endpoints {
+		ep.l.Lock()
+		stats[i] = EndpointStats{
+			Endpoint:       ep.Endpoint,
+			Calls:          ep.calls,
+			Errors:         ep.errors,
+			Latency:        ep.latency,
+			Healthy:        !now.Before(ep.downUntil),
+			UnhealthyUntil: ep.downUntil,
+			Pool:           ep.pool.Stats(),
+		}
+		if ep.lastErr != nil {
+			stats[i].LastError = ep.lastErr.Error()
+		}
+		ep.l.Unlock()
 	}
+	return stats
 }
 
-func (e *EvmConnectPoll) Call(f func(*ethclient.Client, *rpc.Client) error) error {
-	return e.ConnectPoll.Call(func(closeable Closeable) error {
-		if client, ok := closeable.(*rpc.Client); ok {
-			return f(ethclient.NewClient(client), client)
+// order 返回本次调用尝试地址的顺序
+// 可用的地址按优先级排序，同一优先级按权重随机排列；暂停使用的地址放在最后，最早恢复的在前
+func (e *EvmConnectPoll) order() []*endpoint {
+	if len(e.endpoints) == 1 {
+		return e.endpoints
+	}
+	now := time.Now()
+	var healthy, down []*endpoint
+	for _, ep := range e.endpoints {
+		if ep.healthy(now) {
+			healthy = append(healthy, ep)
 		} else {
-			return ConnectError
+			down = append(down, ep)
+		}
+	}
+	healthy = e.weightedShuffle(healthy)
+	sort.SliceStable(healthy, func(i, j int) bool {
+		return healthy[i].Priority < healthy[j].Priority
+	})
+	sort.Slice(down, func(i, j int) bool {
+		return down[i].until().Before(down[j].until())
+	})
+	return append(healthy, down...)
+}
+
+// weightedShuffle 按权重不放回地随机抽取，权重越大越可能靠前
+func (e *EvmConnectPoll) weightedShuffle(endpoints []*endpoint) []*endpoint {
+	e.randLock.Lock()
+	defer e.randLock.Unlock()
+	result := make([]*endpoint, 0, len(endpoints))
+	rest := append([]*endpoint(nil), endpoints...)
+	for len(rest) > 0 {
+		total := 0
+		for _, ep := range rest {
+			total += ep.Weight
+		}
+		n := e.rand.Intn(total)
+		for i, ep := range rest {
+			if n < ep.Weight {
+				result = append(result, ep)
+				rest = append(rest[:i], rest[i+1:]...)
+				break
+			}
+			n -= ep.Weight
 		}
+	}
+	return result
+}
+
+func (ep *endpoint) call(ctx context.Context, f func(*ethclient.Client, *rpc.Client) error) error {
+	start := time.Now()
+	err := ep.pool.Call(ctx, func(conn *EvmConn) error {
+		return f(conn.Eth, conn.Rpc)
 	})
+	if ctx.Err() == nil && !errors.Is(err, ErrPoolClosed) {
+		ep.record(time.Since(start), err)
+	}
+	return err
+}
+
+// record 记录调用耗时及结果，需要切换地址的错误会让该地址暂停使用一段时间
+func (ep *endpoint) record(latency time.Duration, err error) {
+	ep.l.Lock()
+	defer ep.l.Unlock()
+	ep.calls++
+	if ep.latency == 0 {
+		ep.latency = latency
+	} else {
+		ep.latency += time.Duration(latencySmoothing * float64(latency-ep.latency))
+	}
+	if err == nil || !shouldFailover(err) {
+		ep.failures = 0
+		ep.downUntil = time.Time{}
+		return
+	}
+	ep.errors++
+	ep.failures++
+	ep.lastErr = err
+	cooldown := maxEndpointCooldown
+	if ep.failures <= 6 {
+		cooldown = endpointCooldown << (ep.failures - 1)
+	}
+	ep.downUntil = time.Now().Add(cooldown)
+}
+
+func (ep *endpoint) healthy(now time.Time) bool {
+	return !now.Before(ep.until())
+}
+
+func (ep *endpoint) until() time.Time {
+	ep.l.Lock()
+	defer ep.l.Unlock()
+	return ep.downUntil
+}
+
+// shouldFailover 判断错误是否与 rpc 地址有关，换一个地址可能成功
+// 连接错误、http 429 及 5xx、限流错误返回 true，revert、nonce too low 等 json-rpc 错误返回 false
+func shouldFailover(err error) bool {
+	if errors.Is(err, ConnectError) || isEvmTransportError(err) || IsRateLimited(err) {
+		return true
+	}
+	var httpErr rpc.HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= http.StatusInternalServerError
+}
+
+// IsRateLimited 判断错误是否是 rpc 服务商限流
+func IsRateLimited(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == rpcLimitExceeded {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests")
+}
+
+// pingEvm 使用 eth_chainId 检查连接是否可用，最多等待 evmPingTimeout
+func pingEvm(ctx context.Context, conn *EvmConn) error {
+	ctx, cancel := context.WithTimeout(ctx, evmPingTimeout)
+	defer cancel()
+	var chainId string
+	return conn.Rpc.CallContext(ctx, &chainId, "eth_chainId")
+}
+
+func isEvmTransportError(err error) bool {
+	return IsTransportError(err) || errors.Is(err, rpc.ErrClientQuit)
 }
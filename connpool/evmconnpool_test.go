@@ -0,0 +1,130 @@
+package connpool
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeEth 只实现 eth_chainId 的 rpc 节点
+type fakeEth struct {
+	chainId int64
+	err     error // 不为空时 eth_chainId 返回此错误
+	calls   int32
+}
+
+func (f *fakeEth) ChainId() (*hexutil.Big, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return (*hexutil.Big)(big.NewInt(f.chainId)), nil
+}
+
+func newFakeNode(t *testing.T, eth *fakeEth) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", eth); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Stop()
+	})
+	return httpServer.URL
+}
+
+func TestEvmConnReusesClientWrapper(t *testing.T) {
+	url := newFakeNode(t, &fakeEth{chainId: 5})
+	pool := NewEvmConnectPoll([]Endpoint{{Url: url}}, EvmOptions{MaxConnect: 1})
+	defer pool.Close()
+
+	var (
+		eths []*ethclient.Client
+		rpcs []*rpc.Client
+	)
+	for i := 0; i < 3; i++ {
+		err := pool.Call(context.Background(), func(c1 *ethclient.Client, c2 *rpc.Client) error {
+			eths = append(eths, c1)
+			rpcs = append(rpcs, c2)
+			_, err := c1.ChainID(context.Background())
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(eths); i++ {
+		if eths[i] != eths[0] || rpcs[i] != rpcs[0] {
+			t.Fatal("ethclient wrapper recreated for a pooled connection")
+		}
+	}
+	if s := pool.EndpointStats()[0]; s.Pool.Dials != 1 || s.Calls != 3 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestEvmFailoverOnRateLimit(t *testing.T) {
+	limited := &fakeEth{chainId: 5, err: errors.New("rate limit exceeded")}
+	backup := &fakeEth{chainId: 5}
+	pool := NewEvmConnectPoll([]Endpoint{
+		{Url: newFakeNode(t, limited), Priority: 0},
+		{Url: newFakeNode(t, backup), Priority: 1},
+	}, EvmOptions{MaxConnect: 1})
+	defer pool.Close()
+
+	chainId := func() error {
+		return pool.Call(context.Background(), func(c1 *ethclient.Client, _ *rpc.Client) error {
+			_, err := c1.ChainID(context.Background())
+			return err
+		})
+	}
+	if err := chainId(); err != nil {
+		t.Fatal(err)
+	}
+	if l, b := atomic.LoadInt32(&limited.calls), atomic.LoadInt32(&backup.calls); l != 1 || b != 1 {
+		t.Fatalf("calls limited %d backup %d, want 1 and 1", l, b)
+	}
+	stats := pool.EndpointStats()
+	if stats[0].Errors != 1 || stats[0].Healthy {
+		t.Fatalf("rate limited endpoint not marked unhealthy: %+v", stats[0])
+	}
+
+	// 暂停使用期间直接调用备用地址
+	if err := chainId(); err != nil {
+		t.Fatal(err)
+	}
+	if l, b := atomic.LoadInt32(&limited.calls), atomic.LoadInt32(&backup.calls); l != 1 || b != 2 {
+		t.Fatalf("calls limited %d backup %d, want 1 and 2", l, b)
+	}
+}
+
+func TestEvmNoFailoverOnRpcError(t *testing.T) {
+	reverted := &fakeEth{err: errors.New("execution reverted")}
+	backup := &fakeEth{chainId: 5}
+	pool := NewEvmConnectPoll([]Endpoint{
+		{Url: newFakeNode(t, reverted), Priority: 0},
+		{Url: newFakeNode(t, backup), Priority: 1},
+	}, EvmOptions{MaxConnect: 1})
+	defer pool.Close()
+
+	err := pool.Read(context.Background(), func(c1 *ethclient.Client, _ *rpc.Client) error {
+		_, err := c1.ChainID(context.Background())
+		return err
+	})
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("err = %v, want the json-rpc error", err)
+	}
+	if r, b := atomic.LoadInt32(&reverted.calls), atomic.LoadInt32(&backup.calls); r != 1 || b != 0 {
+		t.Fatalf("json-rpc error retried: calls %d backup %d", r, b)
+	}
+}
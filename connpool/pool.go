@@ -1,84 +1,476 @@
 package connpool
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"sync"
-	"sync/atomic"
+	"time"
 )
 
 var (
 	ConnectError = errors.New("connect error")
+	// ErrPoolClosed 连接池关闭后调用 Call 返回的错误
+	ErrPoolClosed = errors.New("connection pool closed")
+)
+
+const (
+	defaultMaxIdleTime    = 5 * time.Minute
+	defaultMaxLifetime    = 30 * time.Minute
+	defaultPingAfter      = 30 * time.Second
+	defaultDialAttempts   = 3
+	defaultDialBackoff    = 200 * time.Millisecond
+	defaultMaxDialBackoff = 5 * time.Second
 )
 
 type Closeable interface {
 	Close()
 }
 
-// ConnectPoll 构建基础的连接池
-// 支持 最大连接数 配置
-type ConnectPoll struct {
-	New      func() Closeable
-	ch       chan Closeable
-	using    int32
-	maxCount int32
+// Options 连接池的可选参数，零值字段使用默认值
+type Options[T Closeable] struct {
+	MaxIdleTime time.Duration // 连接空闲超过此时间后关闭
+	MaxLifetime time.Duration // 连接建立超过此时间后关闭
+	PingAfter   time.Duration // 连接空闲超过此时间，取出时先用 Ping 检查
+	// Ping 检查连接是否可用，ctx 为获取连接的 ctx，为空时不检查
+	Ping func(ctx context.Context, cn T) error
+	// IsTransportError 判断 Call 返回的错误是否是连接错误，是则关闭连接，为空时使用 IsTransportError
+	IsTransportError func(error) bool
+
+	DialAttempts   int           // 建立连接失败时的重试次数
+	DialBackoff    time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDialBackoff time.Duration // 重试等待时间上限
+}
+
+func (o Options[T]) withDefaults() Options[T] {
+	if o.MaxIdleTime == 0 {
+		o.MaxIdleTime = defaultMaxIdleTime
+	}
+	if o.MaxLifetime == 0 {
+		o.MaxLifetime = defaultMaxLifetime
+	}
+	if o.PingAfter == 0 {
+		o.PingAfter = defaultPingAfter
+	}
+	if o.IsTransportError == nil {
+		o.IsTransportError = IsTransportError
+	}
+	if o.DialAttempts == 0 {
+		o.DialAttempts = defaultDialAttempts
+	}
+	if o.DialBackoff == 0 {
+		o.DialBackoff = defaultDialBackoff
+	}
+	if o.MaxDialBackoff == 0 {
+		o.MaxDialBackoff = defaultMaxDialBackoff
+	}
+	return o
+}
+
+// conn 连接池中的连接
+type conn[T Closeable] struct {
+	c        T
+	created  time.Time
+	lastUsed time.Time
+}
+
+// Pool 构建基础的连接池，T 为连接类型，如 rpc 连接及其 ethclient 封装
+// 支持 最大连接数、空闲超时、最大存活时间、取出时 Ping 检查、建立连接失败重试，连接错误的连接不再放回连接池
+// 有空闲连接时后台定期关闭空闲超时及超过最大存活时间的连接
+// 连接数达到上限时调用方按先来后到排队，排队时间受 ctx 限制
+type Pool[T Closeable] struct {
+	// New 建立一个新连接，ctx 为触发建立连接的调用方的 ctx
+	New  func(ctx context.Context) (T, error)
+	opts Options[T]
+
 	l        sync.Mutex
+	idle     []*conn[T]      // 空闲连接，后放回的先取出
+	waiters  []chan *conn[T] // 等待连接的调用方，收到 nil 表示已为其预留名额，需要自己建立连接
+	using    int32           // 使用中的连接数，包括正在建立的连接
+	open     int32           // 已建立及正在建立的连接数，open = using + len(idle)
+	maxCount int32
+	closing  bool          // Close 或 Shutdown 之后为 true，不再接受新的调用
+	reaping  bool          // 后台清理空闲连接的 goroutine 是否在运行
+	done     chan struct{} // closing 之后使用中的连接全部归还时关闭
+
+	// 以下为 Stats 的累计计数，由 l 保护
+	dials        uint64
+	dialFailures uint64
+	closed       uint64
+	waitTimeouts uint64
+	wait         histogram
+}
+
+// ConnectPoll 连接类型为 Closeable 的连接池
+type ConnectPoll = Pool[Closeable]
+
+func NewConnectPoll(maxCount int32, f func(ctx context.Context) (Closeable, error), opts Options[Closeable]) *ConnectPoll {
+	return NewPool(maxCount, f, opts)
 }
 
-func NewConnectPoll(maxCount int32, f func() Closeable) *ConnectPoll {
-	ch := make(chan Closeable, maxCount)
-	return &ConnectPoll{
+// NewPool 创建连接类型为 T 的连接池，f 建立一个新连接，应在 ctx 结束时放弃建立连接
+// maxCount 小于 1 时按 1 处理，否则所有调用会一直等待
+func NewPool[T Closeable](maxCount int32, f func(ctx context.Context) (T, error), opts Options[T]) *Pool[T] {
+	if maxCount < 1 {
+		maxCount = 1
+	}
+	return &Pool[T]{
 		New:      f,
+		opts:     opts.withDefaults(),
 		maxCount: maxCount,
-		ch:       ch,
+		done:     make(chan struct{}),
+		wait:     newHistogram(defaultWaitBuckets),
 	}
 }
 
-func (c *ConnectPoll) Call(f func(closeable Closeable) error) error {
+// Call 从连接池取出连接调用 f，ctx 限制等待及建立连接的时间
+// f panic 时关闭连接并释放名额，然后继续 panic
+func (c *Pool[T]) Call(ctx context.Context, f func(T) error) (err error) {
+	start := time.Now()
+	cn, err := c.get(ctx)
 	c.l.Lock()
-	conn := c.get()
-	atomic.AddInt32(&c.using, 1)
+	if err == nil {
+		c.wait.observe(time.Since(start))
+	} else if ctx.Err() != nil {
+		c.waitTimeouts++
+	}
 	c.l.Unlock()
+	if err != nil {
+		return err
+	}
+
+	done := false
+	defer func() {
+		switch {
+		case !done:
+			// f panic，连接状态未知，直接关闭
+			c.discard(cn)
+		case err != nil && (errors.Is(err, ConnectError) || c.opts.IsTransportError(err)):
+			c.discard(cn)
+		default:
+			c.put(cn)
+		}
+	}()
+	err = f(cn.c)
+	done = true
+	return err
+}
+
+// get 从连接池获取连接，过期或 Ping 失败的连接会被关闭
+func (c *Pool[T]) get(ctx context.Context) (*conn[T], error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c.l.Lock()
+		if c.closing {
+			c.l.Unlock()
+			return nil, ErrPoolClosed
+		}
+		// 有人排队时新来的调用方不能直接取空闲连接，保证先来先得
+		if len(c.idle) > 0 && len(c.waiters) == 0 {
+			cn := c.idle[len(c.idle)-1]
+			c.idle = c.idle[:len(c.idle)-1]
+			c.using++
+			c.l.Unlock()
+			if !c.healthy(ctx, cn) {
+				c.discard(cn)
+				continue
+			}
+			return cn, nil
+		}
+		if c.open < c.maxCount && len(c.waiters) == 0 {
+			c.open++
+			c.using++
+			c.l.Unlock()
+			return c.dialReserved(ctx)
+		}
+
+		w := make(chan *conn[T], 1)
+		c.waiters = append(c.waiters, w)
+		c.l.Unlock()
+
+		select {
+		case cn, ok := <-w:
+			if !ok {
+				return nil, ErrPoolClosed
+			}
+			if cn == nil {
+				return c.dialReserved(ctx)
+			}
+			return cn, nil
+		case <-ctx.Done():
+			c.l.Lock()
+			removed := c.removeWaiter(w)
+			c.l.Unlock()
+			if !removed {
+				// 取消的同时已经分配了连接或名额，归还给下一个调用方；连接池关闭时 w 被关闭，不需要归还
+				if cn, ok := <-w; ok && cn != nil {
+					c.put(cn)
+				} else if ok {
+					c.release()
+				}
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
 
-	if nil == conn {
-		atomic.AddInt32(&c.using, -1)
-		return ConnectError
+func (c *Pool[T]) removeWaiter(w chan *conn[T]) bool {
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
 	}
+	return false
+}
 
-	err := f(conn)
+// healthy 检查空闲连接是否超时，空闲较久的连接使用 Ping 检查，Ping 受获取连接的 ctx 限制
+func (c *Pool[T]) healthy(ctx context.Context, cn *conn[T]) bool {
+	now := time.Now()
+	if now.Sub(cn.created) > c.opts.MaxLifetime || now.Sub(cn.lastUsed) > c.opts.MaxIdleTime {
+		return false
+	}
+	if c.opts.Ping != nil && now.Sub(cn.lastUsed) > c.opts.PingAfter {
+		return c.opts.Ping(ctx, cn.c) == nil
+	}
+	return true
+}
 
-	if err != nil && errors.Is(err, ConnectError) {
-		conn.Close()
-	} else {
-		success := c.put(conn)
-		if !success {
-			conn.Close()
+// dialReserved 使用已预留的名额建立新连接，失败时按指数退避重试，最终失败时释放名额
+func (c *Pool[T]) dialReserved(ctx context.Context) (*conn[T], error) {
+	var err error
+	backoff := c.opts.DialBackoff
+	for attempt := 0; attempt < c.opts.DialAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				c.release()
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > c.opts.MaxDialBackoff {
+				backoff = c.opts.MaxDialBackoff
+			}
+		}
+		var (
+			cn        *conn[T]
+			abandoned bool
+		)
+		cn, abandoned, err = c.dial(ctx)
+		if abandoned {
+			return nil, err
+		}
+		if err == nil {
+			return cn, nil
 		}
 	}
-	atomic.AddInt32(&c.using, -1)
-	return err
+	c.release()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, fmt.Errorf("%w: %v", ConnectError, err)
 }
 
-// get 从连接池获取连接
-func (c *ConnectPoll) get() Closeable {
+// dial 调用 New 建立一个连接，ctx 结束时不再等待 New 返回，abandoned 为 true 并返回 ctx 的错误
+// 此时名额交给后台处理：New 返回后关闭建立的连接并释放名额，调用方不需要再释放
+func (c *Pool[T]) dial(ctx context.Context) (cn *conn[T], abandoned bool, err error) {
+	type result struct {
+		c   T
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		closeable, err := c.New(ctx)
+		if err == nil && any(closeable) == nil {
+			err = errors.New("dial returned no connection")
+		}
+		c.l.Lock()
+		c.dials++
+		if err != nil {
+			c.dialFailures++
+		}
+		c.l.Unlock()
+		res <- result{closeable, err}
+	}()
+
 	select {
-	case ch := <-c.ch:
-		return ch
-	default:
-		if c.using >= c.maxCount {
-			ch := <-c.ch
-			return ch
-		} else {
-			return c.New()
+	case r := <-res:
+		if r.err != nil {
+			return nil, false, r.err
+		}
+		now := time.Now()
+		return &conn[T]{c: r.c, created: now, lastUsed: now}, false, nil
+	case <-ctx.Done():
+		go func() {
+			r := <-res
+			if r.err == nil {
+				r.c.Close()
+				c.l.Lock()
+				c.closed++
+				c.l.Unlock()
+			}
+			c.release()
+		}()
+		return nil, true, ctx.Err()
+	}
+}
+
+// put 把一个连接放回连接池，有人排队时直接交给第一个等待的调用方，连接池关闭后直接关闭连接
+func (c *Pool[T]) put(cn *conn[T]) {
+	cn.lastUsed = time.Now()
+	c.l.Lock()
+	if c.closing {
+		c.l.Unlock()
+		c.discard(cn)
+		return
+	}
+	defer c.l.Unlock()
+	if len(c.waiters) > 0 {
+		w := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		w <- cn
+		return
+	}
+	c.using--
+	c.idle = append(c.idle, cn)
+	if !c.reaping {
+		c.reaping = true
+		go c.reap(c.reapInterval())
+	}
+}
+
+// reapInterval 后台清理的间隔，为空闲超时与最大存活时间较小值的一半
+func (c *Pool[T]) reapInterval() time.Duration {
+	d := c.opts.MaxIdleTime
+	if c.opts.MaxLifetime < d {
+		d = c.opts.MaxLifetime
+	}
+	if d /= 2; d <= 0 {
+		d = time.Millisecond
+	}
+	return d
+}
+
+// reap 定期检查整个空闲列表，关闭空闲超时或超过最大存活时间的连接
+// 取出连接时只检查最后放回的连接，列表底部长期不用的连接需要在这里关闭；空闲列表为空或连接池关闭后退出
+func (c *Pool[T]) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.l.Lock()
+		now := time.Now()
+		var expired []*conn[T]
+		idle := c.idle[:0]
+		for _, cn := range c.idle {
+			if now.Sub(cn.created) > c.opts.MaxLifetime || now.Sub(cn.lastUsed) > c.opts.MaxIdleTime {
+				expired = append(expired, cn)
+			} else {
+				idle = append(idle, cn)
+			}
+		}
+		for i := len(idle); i < len(c.idle); i++ {
+			c.idle[i] = nil
+		}
+		c.idle = idle
+		c.open -= int32(len(expired))
+		c.closed += uint64(len(expired))
+		stop := c.closing || len(c.idle) == 0
+		if stop {
+			c.reaping = false
+		}
+		c.l.Unlock()
+
+		for _, cn := range expired {
+			cn.c.Close()
+		}
+		if stop {
+			return
 		}
 	}
 }
 
-// put 把一个连接放入连接池
-func (c *ConnectPoll) put(o Closeable) bool {
+// discard 关闭连接，并释放名额
+func (c *Pool[T]) discard(cn *conn[T]) {
+	cn.c.Close()
+	c.l.Lock()
+	c.closed++
+	c.l.Unlock()
+	c.release()
+}
+
+// release 释放一个使用中的名额，有人排队时把名额交给第一个等待的调用方
+func (c *Pool[T]) release() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if len(c.waiters) > 0 {
+		w := c.waiters[0]
+		c.waiters = c.waiters[1:]
+		w <- nil
+		return
+	}
+	c.using--
+	c.open--
+	c.checkDone()
+}
+
+// checkDone 连接池关闭后，使用中的连接全部归还时通知 Shutdown，调用时需持有 l
+func (c *Pool[T]) checkDone() {
+	if !c.closing || c.using > 0 {
+		return
+	}
 	select {
-	case c.ch <- o:
-		return true
+	case <-c.done:
 	default:
-		return false
+		close(c.done)
+	}
+}
+
+// Close 关闭连接池，等待进行中的调用结束
+func (c *Pool[T]) Close() {
+	_ = c.Shutdown(context.Background())
+}
+
+// Shutdown 拒绝新的调用，唤醒排队的调用方，关闭空闲连接，并等待进行中的调用结束后关闭其连接
+// ctx 结束时不再等待并返回 ctx 的错误，之后归还的连接仍会被关闭
+func (c *Pool[T]) Shutdown(ctx context.Context) error {
+	c.l.Lock()
+	var idle []*conn[T]
+	if !c.closing {
+		c.closing = true
+		idle = c.idle
+		c.idle = nil
+		c.open -= int32(len(idle))
+		c.closed += uint64(len(idle))
+		for _, w := range c.waiters {
+			close(w)
+		}
+		c.waiters = nil
+		c.checkDone()
+	}
+	c.l.Unlock()
+	for _, cn := range idle {
+		cn.c.Close()
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
+
+// IsTransportError 判断错误是否由连接本身导致，如网络错误、连接被关闭
+// json-rpc 返回的错误（如 revert、nonce too low）不是连接错误
+func IsTransportError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,503 @@
+package connpool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeConn 测试用连接，记录是否被关闭
+type fakeConn struct {
+	id     int32
+	closed int32
+}
+
+func (c *fakeConn) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+}
+
+// fakeDialer 记录建立过的连接
+type fakeDialer struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+	delay time.Duration // 建立连接的耗时，不理会 ctx
+	fail  int           // 前 fail 次建立连接失败
+}
+
+func (d *fakeDialer) dial(ctx context.Context) (*fakeConn, error) {
+	if d.delay > 0 {
+		time.Sleep(d.delay)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fail > 0 {
+		d.fail--
+		return nil, errors.New("dial failed")
+	}
+	cn := &fakeConn{id: int32(len(d.conns) + 1)}
+	d.conns = append(d.conns, cn)
+	return cn, nil
+}
+
+func (d *fakeDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+// waitFor 等待 cond 成立，超时时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCallConcurrentRespectsMaxCount(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(3, d.dial, Options[*fakeConn]{})
+	defer p.Close()
+
+	var inUse, maxInUse int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.Call(context.Background(), func(*fakeConn) error {
+				n := atomic.AddInt32(&inUse, 1)
+				for {
+					m := atomic.LoadInt32(&maxInUse)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInUse, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inUse, -1)
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInUse > 3 {
+		t.Fatalf("max in use %d, want <= 3", maxInUse)
+	}
+	if n := d.count(); n > 3 {
+		t.Fatalf("dialed %d connections, want <= 3", n)
+	}
+	s := p.Stats()
+	if s.InUse != 0 || s.Waiters != 0 || s.Open != s.Idle {
+		t.Fatalf("unexpected stats after all calls returned: %+v", s)
+	}
+	if s.Wait.Count != 50 {
+		t.Fatalf("wait histogram count %d, want 50", s.Wait.Count)
+	}
+}
+
+func TestNewPoolClampsMaxCount(t *testing.T) {
+	for _, maxCount := range []int32{0, -3} {
+		d := &fakeDialer{}
+		p := NewPool(maxCount, d.dial, Options[*fakeConn]{})
+		if s := p.Stats(); s.MaxOpen != 1 {
+			t.Fatalf("NewPool(%d) max open %d, want 1", maxCount, s.MaxOpen)
+		}
+		// 不应一直排队等待连接
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		for i := 0; i < 3; i++ {
+			if err := p.Call(ctx, func(*fakeConn) error { return nil }); err != nil {
+				t.Fatalf("NewPool(%d) call: %v", maxCount, err)
+			}
+		}
+		cancel()
+		if d.count() != 1 {
+			t.Fatalf("NewPool(%d) dialed %d connections, want 1", maxCount, d.count())
+		}
+		p.Close()
+	}
+}
+
+func TestCallQueuedTimesOut(t *testing.T) {
+	p := NewPool(1, (&fakeDialer{}).dial, Options[*fakeConn]{})
+	defer p.Close()
+
+	hold := make(chan struct{})
+	held := make(chan struct{})
+	go p.Call(context.Background(), func(*fakeConn) error {
+		close(held)
+		<-hold
+		return nil
+	})
+	<-held
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.Call(ctx, func(*fakeConn) error {
+		t.Error("f called without a free connection")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("queued call returned after %s", elapsed)
+	}
+	close(hold)
+
+	waitFor(t, "connection returned", func() bool { return p.Stats().Idle == 1 })
+	s := p.Stats()
+	if s.Waiters != 0 || s.InUse != 0 || s.WaitTimeouts != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestCallSlowDialBoundedByContext(t *testing.T) {
+	d := &fakeDialer{delay: 300 * time.Millisecond}
+	p := NewPool(1, d.dial, Options[*fakeConn]{})
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.Call(ctx, func(*fakeConn) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("call with 20ms ctx returned after %s", elapsed)
+	}
+
+	// 超时后建立的连接被关闭，名额释放
+	waitFor(t, "abandoned dial released", func() bool { return p.Stats().Open == 0 })
+	if n := d.count(); n != 1 || atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatalf("abandoned connection not closed")
+	}
+	if err = p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallPanicReleasesConnection(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(1, d.dial, Options[*fakeConn]{})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic not propagated")
+			}
+		}()
+		_ = p.Call(context.Background(), func(*fakeConn) error { panic("boom") })
+	}()
+
+	s := p.Stats()
+	if s.InUse != 0 || s.Open != 0 {
+		t.Fatalf("slot not released after panic: %+v", s)
+	}
+	if atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatal("connection used by a panicking call not closed")
+	}
+	if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close hangs after a panicking call")
+	}
+}
+
+func TestShutdownWakesWaiters(t *testing.T) {
+	p := NewPool(1, (&fakeDialer{}).dial, Options[*fakeConn]{})
+
+	hold := make(chan struct{})
+	held := make(chan struct{})
+	go p.Call(context.Background(), func(*fakeConn) error {
+		close(held)
+		<-hold
+		return nil
+	})
+	<-held
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Call(context.Background(), func(*fakeConn) error { return nil })
+	}()
+	waitFor(t, "waiter queued", func() bool { return p.Stats().Waiters == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown with a call in progress = %v, want deadline exceeded", err)
+	}
+	if err := <-errc; !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("queued call err = %v, want ErrPoolClosed", err)
+	}
+	close(hold)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("call after shutdown err = %v, want ErrPoolClosed", err)
+	}
+}
+
+func TestIdleConnectionsReaped(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(3, d.dial, Options[*fakeConn]{MaxIdleTime: 50 * time.Millisecond})
+	defer p.Close()
+
+	// 同时使用 3 个连接，全部放回后空闲列表中有 3 个连接
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = p.Call(context.Background(), func(*fakeConn) error {
+				<-start
+				return nil
+			})
+		}()
+	}
+	waitFor(t, "3 connections in use", func() bool { return p.Stats().InUse == 3 })
+	close(start)
+	wg.Wait()
+	if s := p.Stats(); s.Idle != 3 {
+		t.Fatalf("idle = %d, want 3", s.Idle)
+	}
+
+	// 没有再次取出连接，空闲超时后全部被关闭
+	waitFor(t, "idle connections reaped", func() bool { return p.Stats().Open == 0 })
+	for _, cn := range d.conns {
+		if atomic.LoadInt32(&cn.closed) == 0 {
+			t.Fatalf("connection %d not closed", cn.id)
+		}
+	}
+	waitFor(t, "reaper stopped", func() bool {
+		p.l.Lock()
+		defer p.l.Unlock()
+		return !p.reaping
+	})
+
+	if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n := d.count(); n != 4 {
+		t.Fatalf("dialed %d connections, want 4", n)
+	}
+}
+
+func TestConnectionsPastLifetimeReaped(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(1, d.dial, Options[*fakeConn]{MaxLifetime: 50 * time.Millisecond})
+	defer p.Close()
+
+	// 持续使用的连接超过最大存活时间后同样被关闭
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := d.count(); n < 2 {
+		t.Fatalf("dialed %d connections, want the first one replaced", n)
+	}
+	if atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatal("connection past max lifetime not closed")
+	}
+}
+
+func TestWaitersServedInOrder(t *testing.T) {
+	p := NewPool(1, (&fakeDialer{}).dial, Options[*fakeConn]{})
+	defer p.Close()
+
+	hold := make(chan struct{})
+	held := make(chan struct{})
+	go p.Call(context.Background(), func(*fakeConn) error {
+		close(held)
+		<-hold
+		return nil
+	})
+	<-held
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 1; i <= 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = p.Call(context.Background(), func(*fakeConn) error {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return nil
+			})
+		}(i)
+		// 上一个调用方排队后再启动下一个，保证排队顺序
+		waitFor(t, "waiter queued", func() bool { return p.Stats().Waiters == i })
+	}
+	close(hold)
+	wg.Wait()
+
+	for i, id := range order {
+		if id != i+1 {
+			t.Fatalf("waiters served in order %v, want 1..5", order)
+		}
+	}
+}
+
+func TestPingEvictsUnhealthyConnection(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(1, d.dial, Options[*fakeConn]{
+		PingAfter: time.Millisecond,
+		Ping: func(ctx context.Context, cn *fakeConn) error {
+			if cn.id == 1 {
+				return errors.New("connection reset")
+			}
+			return nil
+		},
+	})
+	defer p.Close()
+
+	var used []int32
+	call := func() {
+		if err := p.Call(context.Background(), func(cn *fakeConn) error {
+			used = append(used, cn.id)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	call()
+	time.Sleep(5 * time.Millisecond)
+	call()
+
+	if len(used) != 2 || used[0] != 1 || used[1] != 2 {
+		t.Fatalf("used connections %v, want [1 2]", used)
+	}
+	if atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatal("connection failing ping not closed")
+	}
+	if s := p.Stats(); s.Open != 1 || s.Closed != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestPingBoundedByCallContext(t *testing.T) {
+	d := &fakeDialer{}
+	var pinged int32
+	p := NewPool(1, d.dial, Options[*fakeConn]{
+		PingAfter: time.Millisecond,
+		// 连接无响应，Ping 直到 ctx 结束才返回
+		Ping: func(ctx context.Context, cn *fakeConn) error {
+			atomic.AddInt32(&pinged, 1)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	defer p.Close()
+
+	if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.Call(ctx, func(*fakeConn) error {
+		t.Error("f called with a connection failing ping")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("call with 20ms ctx returned after %s", elapsed)
+	}
+	if atomic.LoadInt32(&pinged) != 1 {
+		t.Fatalf("pinged %d times, want 1", pinged)
+	}
+	// 未通过 Ping 的连接被关闭，名额释放
+	if s := p.Stats(); s.Open != 0 || s.InUse != 0 || atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatalf("connection failing ping not released: %+v", s)
+	}
+}
+
+func TestTransportErrorEvictsConnection(t *testing.T) {
+	d := &fakeDialer{}
+	p := NewPool(1, d.dial, Options[*fakeConn]{})
+	defer p.Close()
+
+	if err := p.Call(context.Background(), func(*fakeConn) error { return io.EOF }); !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+	if atomic.LoadInt32(&d.conns[0].closed) == 0 {
+		t.Fatal("connection returning a transport error not closed")
+	}
+	// 其他错误不影响连接
+	if err := p.Call(context.Background(), func(*fakeConn) error { return errors.New("execution reverted") }); err == nil {
+		t.Fatal("error not returned")
+	}
+	if s := p.Stats(); s.Idle != 1 || d.count() != 2 {
+		t.Fatalf("unexpected stats: %+v, dialed %d", s, d.count())
+	}
+}
+
+func TestDialRetriesWithBackoff(t *testing.T) {
+	d := &fakeDialer{fail: 2}
+	p := NewPool(1, d.dial, Options[*fakeConn]{DialBackoff: 20 * time.Millisecond})
+	defer p.Close()
+
+	start := time.Now()
+	if err := p.Call(context.Background(), func(*fakeConn) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	// 第二次等待 20ms，第三次等待 40ms
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("dial retried after %s, want backoff of at least 60ms", elapsed)
+	}
+	if s := p.Stats(); s.Dials != 3 || s.DialFailures != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestDialGivesUpAfterAttempts(t *testing.T) {
+	d := &fakeDialer{fail: 5}
+	p := NewPool(1, d.dial, Options[*fakeConn]{DialAttempts: 2, DialBackoff: time.Millisecond})
+	defer p.Close()
+
+	err := p.Call(context.Background(), func(*fakeConn) error {
+		t.Error("f called without a connection")
+		return nil
+	})
+	if !errors.Is(err, ConnectError) {
+		t.Fatalf("err = %v, want ConnectError", err)
+	}
+	if s := p.Stats(); s.Open != 0 || s.InUse != 0 || s.Dials != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,113 @@
+package connpool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// metric Prometheus 文本格式中的一个指标
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func(EndpointStats) float64
+}
+
+var evmMetrics = []metric{
+	{"so_rpc_pool_max_connections", "Maximum connections of the endpoint pool.", "gauge",
+		func(s EndpointStats) float64 { return float64(s.Pool.MaxOpen) }},
+	{"so_rpc_pool_open_connections", "Open and dialing connections.", "gauge",
+		func(s EndpointStats) float64 { return float64(s.Pool.Open) }},
+	{"so_rpc_pool_idle_connections", "Idle connections.", "gauge",
+		func(s EndpointStats) float64 { return float64(s.Pool.Idle) }},
+	{"so_rpc_pool_in_use_connections", "Connections in use, including dialing ones.", "gauge",
+		func(s EndpointStats) float64 { return float64(s.Pool.InUse) }},
+	{"so_rpc_pool_waiters", "Callers waiting for a connection.", "gauge",
+		func(s EndpointStats) float64 { return float64(s.Pool.Waiters) }},
+	{"so_rpc_pool_dials_total", "Dial attempts.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Pool.Dials) }},
+	{"so_rpc_pool_dial_failures_total", "Failed dial attempts.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Pool.DialFailures) }},
+	{"so_rpc_pool_closed_total", "Connections closed because they expired, failed a ping or hit a transport error.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Pool.Closed) }},
+	{"so_rpc_pool_wait_timeouts_total", "Acquisitions abandoned because the context was done.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Pool.WaitTimeouts) }},
+	{"so_rpc_endpoint_calls_total", "Calls routed to the endpoint.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Calls) }},
+	{"so_rpc_endpoint_errors_total", "Calls that failed over to another endpoint.", "counter",
+		func(s EndpointStats) float64 { return float64(s.Errors) }},
+	{"so_rpc_endpoint_latency_seconds", "Moving average of call latency.", "gauge",
+		func(s EndpointStats) float64 { return s.Latency.Seconds() }},
+	{"so_rpc_endpoint_healthy", "1 if the endpoint is in use, 0 while it cools down after errors.", "gauge",
+		func(s EndpointStats) float64 {
+			if s.Healthy {
+				return 1
+			}
+			return 0
+		}},
+}
+
+const waitMetric = "so_rpc_pool_wait_seconds"
+
+// WritePrometheus 按 Prometheus 文本格式输出 rpc 连接池及地址的指标，chains 的 key 为链名
+// 地址只输出 host，避免泄露 url 中的 api key
+func WritePrometheus(w io.Writer, chains map[string][]EndpointStats) error {
+	type series struct {
+		labels string
+		stats  EndpointStats
+	}
+	names := make([]string, 0, len(chains))
+	for name := range chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var all []series
+	for _, name := range names {
+		for i, s := range chains[name] {
+			labels := fmt.Sprintf(`chain="%s",endpoint="%d",host="%s"`, escapeLabel(name), i, escapeLabel(endpointHost(s.Url)))
+			all = append(all, series{labels, s})
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	for _, m := range evmMetrics {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range all {
+			fmt.Fprintf(b, "%s{%s} %s\n", m.name, s.labels, formatFloat(m.value(s.stats)))
+		}
+	}
+	fmt.Fprintf(b, "# HELP %s Time to acquire a connection, including queueing and dialing.\n# TYPE %s histogram\n", waitMetric, waitMetric)
+	for _, s := range all {
+		h := s.stats.Pool.Wait
+		for i, le := range h.Buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", waitMetric, s.labels, formatFloat(le.Seconds()), h.Counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", waitMetric, s.labels, h.Count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", waitMetric, s.labels, formatFloat(h.Sum.Seconds()))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", waitMetric, s.labels, h.Count)
+	}
+	return b.Flush()
+}
+
+func endpointHost(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
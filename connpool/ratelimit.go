@@ -0,0 +1,105 @@
+package connpool
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 200 * time.Millisecond
+	defaultMaxRetryBackoff = 5 * time.Second
+)
+
+// RetryPolicy 幂等读请求的重试策略，零值字段使用默认值
+type RetryPolicy struct {
+	Attempts   int           // 最多调用次数，包括第一次
+	Backoff    time.Duration // 第一次重试前的等待时间，之后每次翻倍，实际等待时间在一半到全部之间随机
+	MaxBackoff time.Duration // 等待时间上限
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts == 0 {
+		p.Attempts = defaultRetryAttempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = defaultRetryBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = defaultMaxRetryBackoff
+	}
+	return p
+}
+
+// backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p RetryPolicy) backoff(attempt int, r *rand.Rand) time.Duration {
+	d := p.MaxBackoff
+	if attempt <= 16 {
+		if exp := p.Backoff << (attempt - 1); exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	return d/2 + time.Duration(r.Int63n(int64(d/2)+1))
+}
+
+// tokenBucket 令牌桶限流，令牌不足时预支令牌并等待，先到的调用方先拿到令牌
+type tokenBucket struct {
+	l      sync.Mutex
+	rate   float64 // 每秒补充的令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket rate 不大于 0 时不限流，返回 nil
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait 取一个令牌，没有令牌时等待，ctx 结束时归还预支的令牌并返回 ctx 的错误
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.l.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.l.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.l.Lock()
+		b.tokens++
+		b.l.Unlock()
+		return ctx.Err()
+	}
+}
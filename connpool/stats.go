@@ -0,0 +1,93 @@
+package connpool
+
+import "time"
+
+// defaultWaitBuckets 获取连接耗时直方图的桶上限
+var defaultWaitBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Stats 连接池的状态及累计计数
+type Stats struct {
+	MaxOpen int // 最大连接数
+	Open    int // 已建立及正在建立的连接数
+	Idle    int // 空闲连接数
+	InUse   int // 使用中的连接数，包括正在建立的连接
+	Waiters int // 排队等待连接的调用方
+
+	Dials        uint64 // 建立连接的次数，包括失败的
+	DialFailures uint64 // 建立连接失败的次数
+	Closed       uint64 // 因过期、Ping 失败或连接错误而关闭的连接数
+	WaitTimeouts uint64 // 获取连接时 ctx 取消或超时的次数
+
+	Wait Histogram // 获取连接的耗时，包括排队及建立连接
+}
+
+// Histogram 耗时直方图，Counts[i] 为耗时不超过 Buckets[i] 的次数（累计），与 Prometheus 一致
+type Histogram struct {
+	Buckets []time.Duration
+	Counts  []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+// histogram 连接池内部记录的直方图，counts 按桶分别计数，最后一个为超过所有桶上限的次数
+type histogram struct {
+	buckets []time.Duration
+	counts  []uint64
+	sum     time.Duration
+}
+
+func newHistogram(buckets []time.Duration) histogram {
+	return histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.buckets) && d > h.buckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += d
+}
+
+func (h *histogram) snapshot() Histogram {
+	result := Histogram{
+		Buckets: append([]time.Duration(nil), h.buckets...),
+		Counts:  make([]uint64, len(h.buckets)),
+		Sum:     h.sum,
+	}
+	for i, n := range h.counts {
+		result.Count += n
+		if i < len(h.buckets) {
+			result.Counts[i] = result.Count
+		}
+	}
+	return result
+}
+
+// Stats 返回连接池当前的状态
+func (c *Pool[T]) Stats() Stats {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return Stats{
+		MaxOpen:      int(c.maxCount),
+		Open:         int(c.open),
+		Idle:         len(c.idle),
+		InUse:        int(c.using),
+		Waiters:      len(c.waiters),
+		Dials:        c.dials,
+		DialFailures: c.dialFailures,
+		Closed:       c.closed,
+		WaitTimeouts: c.waitTimeouts,
+		Wait:         c.wait.snapshot(),
+	}
+}
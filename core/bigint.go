@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/shopspring/decimal"
@@ -13,3 +14,24 @@ func changeDecimals(amount *big.Int, fromDecimal, toDecimal int32) *big.Int {
 	d = d.Mul(decimal.NewFromBigInt(big.NewInt(1), toDecimal)).Div(decimal.NewFromBigInt(big.NewInt(1), fromDecimal))
 	return d.BigInt()
 }
+
+// parseAmount 把可读的数量转换成链上精度的数量，比如精度 6 时 "12.5" 转换为 12500000
+func parseAmount(amount string, decimals int32) (*big.Int, error) {
+	d, err := decimal.NewFromString(amount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	d = d.Shift(decimals)
+	if !d.Equal(d.Truncate(0)) {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", amount, decimals)
+	}
+	if d.Sign() <= 0 {
+		return nil, fmt.Errorf("amount %s must be positive", amount)
+	}
+	return d.BigInt(), nil
+}
+
+// formatAmount 把链上精度的数量转换为可读的数量
+func formatAmount(amount *big.Int, decimals int32) string {
+	return decimal.NewFromBigInt(amount, -decimals).String()
+}
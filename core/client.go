@@ -0,0 +1,98 @@
+package core
+
+import (
+	"io/fs"
+	soabi "so-omnichain-example/abi"
+	"so-omnichain-example/connpool"
+	"so-omnichain-example/display"
+	"so-omnichain-example/signer"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Logger 进度日志输出
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// Options 构造 Client 的参数
+type Options struct {
+	Config Config        // 链配置，可以通过 LoadConfig 读取
+	Signer signer.Signer // 交易签名，只报价时可以为空
+	ABIs   fs.FS         // abi json 文件，为空时使用内置文件，可以通过 abi.WithOverride 覆盖部分文件
+	Logger Logger        // 为空时输出到标准输出
+	Watch  WatchOptions  // 等待交易上链的确认块数及超时
+	// PoolSize 每个 rpc 地址的最大连接数，为 0 时使用 defaultPoolSize
+	PoolSize int
+}
+
+// Client 封装链配置、签名账户、合约 abi 以及 rpc 连接池
+// 多个 Client 之间互不影响
+type Client struct {
+	config  Config
+	account signer.Signer
+	abis    *abiSet
+	logger  Logger
+	watch   WatchOptions
+
+	conns       map[string]*connpool.EvmConnectPoll
+	connMapLock sync.Mutex
+	poolSize    int
+	closed      bool // Shutdown 之后为 true，新建的连接池直接关闭
+	// subs 订阅使用的 websocket 连接，不在连接池中
+	subs map[*ethclient.Client]bool
+	// nonces 本地分配发送交易的 nonce
+	nonces *nonceManager
+
+	// tokenDecimals 缓存从链上读取的 decimals，key 为 链名/token 地址
+	tokenDecimals     map[string]int32
+	tokenDecimalsLock sync.Mutex
+}
+
+func NewClient(opts Options) (*Client, error) {
+	if err := opts.Config.Validate(); err != nil {
+		return nil, err
+	}
+	abiFS := opts.ABIs
+	if abiFS == nil {
+		abiFS = soabi.FS
+	}
+	abis, err := loadAbis(abiFS)
+	if err != nil {
+		return nil, err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = display.Logger{}
+	}
+	poolSize := opts.PoolSize
+	if poolSize <= 0 {
+		poolSize = defaultPoolSize
+	}
+	return &Client{
+		config:        opts.Config,
+		account:       opts.Signer,
+		abis:          abis,
+		logger:        logger,
+		watch:         opts.Watch,
+		conns:         make(map[string]*connpool.EvmConnectPoll),
+		poolSize:      poolSize,
+		subs:          make(map[*ethclient.Client]bool),
+		nonces:        newNonceManager(),
+		tokenDecimals: make(map[string]int32),
+	}, nil
+}
+
+// Config 返回 Client 使用的链配置
+func (c *Client) Config() Config {
+	return c.config
+}
+
+// signer 返回签名账户，未配置时返回 errNoAccount
+func (c *Client) signer() (signer.Signer, error) {
+	if c.account == nil {
+		return nil, errNoAccount
+	}
+	return c.account, nil
+}
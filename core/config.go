@@ -1,14 +1,36 @@
 package core
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+)
+
+// 支持的 swap 合约类型，对应 Chain.Swap 中每一项的第二个元素
+const (
+	swapTypeUniswapV2     = "IUniswapV2Router02"
+	swapTypeUniswapV2Avax = "IUniswapV2Router02AVAX"
+	swapTypeUniswapV3     = "ISwapRouter"
+
+	defaultNetworkKey = "default"
+)
+
 type Config struct {
 	Networks Networks `yaml:"networks"`
 }
 
+// Networks 链注册表
+// config.yaml 中 networks 下除 `default` 以外的每个 key 都是一条链，`default` 指定默认链名
 type Networks struct {
-	Rinkeby      Chain `yaml:"rinkeby"`
-	PolygonTest  Chain `yaml:"polygon-test"`
-	AvaxTest     Chain `yaml:"avax-test"`
-	OptimismTest Chain `yaml:"optimism-test"`
+	Default string
+	Chains  map[string]Chain
 }
 
 type Chain struct {
@@ -22,4 +44,291 @@ type Chain struct {
 	Usdc            string     `yaml:"usdc"`
 	Weth            string     `yaml:"weth"`
 	Swap            [][]string `yaml:"swap"`
+	// Rpcs 更多的 rpc 地址，与 Rpc 一起使用，出错或限流时切换到其他地址
+	Rpcs []RpcEndpoint `yaml:"rpcs"`
+	// RateLimit 整条链每秒最多 rpc 调用次数，为 0 时不限流，RateBurst 为允许的突发次数
+	RateLimit float64 `yaml:"rate_limit"`
+	RateBurst int     `yaml:"rate_burst"`
+	// Retry 幂等读请求（eth_call、estimateGas、查询回执等）遇到限流、5xx 或连接错误时的重试策略
+	Retry RetryConfig `yaml:"retry"`
+	// Tokens token 注册表，key 为小写 symbol
+	// 未配置时会根据 usdc、weth 字段补全 usdc、weth，并补全原生币 eth
+	Tokens map[string]Token `yaml:"tokens"`
+}
+
+// RpcEndpoint rpc 地址及其优先级、权重
+// config.yaml 中可以只写地址，也可以写成 { url: ..., priority: 1, weight: 2 }
+type RpcEndpoint struct {
+	Url      string `yaml:"url"`
+	Priority int    `yaml:"priority"` // 越小越优先，Rpc 字段的优先级为 0
+	Weight   int    `yaml:"weight"`   // 优先级相同时按权重分配调用，为 0 时按 1 处理
+}
+
+func (e *RpcEndpoint) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		e.Url = value.Value
+		return nil
+	}
+	type plain RpcEndpoint
+	return value.Decode((*plain)(e))
+}
+
+// RetryConfig 重试策略，零值字段使用默认值：最多 3 次，从 200ms 开始翻倍，最多等待 5s
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`    // 最多调用次数，包括第一次，1 表示不重试
+	Backoff    time.Duration `yaml:"backoff"`     // 如 "200ms"
+	MaxBackoff time.Duration `yaml:"max_backoff"` // 如 "5s"
+}
+
+// Endpoints 返回链的所有 rpc 地址，Rpc 在前
+func (c Chain) Endpoints() []RpcEndpoint {
+	var endpoints []RpcEndpoint
+	if c.Rpc != "" {
+		endpoints = append(endpoints, RpcEndpoint{Url: c.Rpc})
+	}
+	for _, e := range c.Rpcs {
+		if e.Url != c.Rpc {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// Token 单条链上的一个 token
+type Token struct {
+	Symbol         string `yaml:"symbol"`
+	Address        string `yaml:"address"`         // 原生币不需要配置
+	Decimals       int32  `yaml:"decimals"`        // 为 0 时通过 erc20 decimals() 读取
+	Native         bool   `yaml:"native"`          // 是否为链原生币
+	StargatePoolId int    `yaml:"stargate_poolid"` // 不为 0 时可以直接通过 stargate 跨链
+	Amount         string `yaml:"amount"`          // 默认 swap 数量，如 "10"、"0.02"
+}
+
+// LoadConfig 读取并校验配置文件
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+// Validate 校验所有链配置，任意一条链配置错误都会返回 error
+func (c *Config) Validate() error {
+	return c.Networks.Validate()
+}
+
+func (n *Networks) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return errors.New("networks: expected a mapping")
+	}
+	n.Chains = make(map[string]Chain)
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key := value.Content[i].Value
+		if key == defaultNetworkKey {
+			n.Default = value.Content[i+1].Value
+			continue
+		}
+		var chain Chain
+		if err := value.Content[i+1].Decode(&chain); err != nil {
+			return fmt.Errorf("networks.%s: %w", key, err)
+		}
+		if chain.Name == "" {
+			chain.Name = key
+		}
+		chain.initTokens()
+		n.Chains[key] = chain
+	}
+	return nil
+}
+
+// Names 返回所有链名，按字母序排列
+func (n Networks) Names() []string {
+	names := make([]string, 0, len(n.Chains))
+	for name := range n.Chains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get 根据链名或者 evm chain id 查找链配置，空字符串表示默认链
+func (n Networks) Get(name string) (Chain, error) {
+	if name == "" || name == defaultNetworkKey {
+		name = n.Default
+	}
+	if chain, ok := n.Chains[name]; ok {
+		return chain, nil
+	}
+	if chainId, err := strconv.Atoi(name); err == nil {
+		return n.ByChainId(chainId)
+	}
+	return Chain{}, fmt.Errorf("%w: %s", errUnsupportChain, name)
+}
+
+// ByChainId 根据 evm chain id 查找链配置
+func (n Networks) ByChainId(chainId int) (Chain, error) {
+	for _, chain := range n.Chains {
+		if chain.ChainId == chainId {
+			return chain, nil
+		}
+	}
+	return Chain{}, fmt.Errorf("%w: chain id %d", errUnsupportChain, chainId)
+}
+
+// ByStargateChainId 根据 stargate chain id 查找链配置
+func (n Networks) ByStargateChainId(stargateChainId int) (Chain, error) {
+	for _, chain := range n.Chains {
+		if chain.StargateChainId == stargateChainId {
+			return chain, nil
+		}
+	}
+	return Chain{}, fmt.Errorf("%w: stargate chain id %d", errUnsupportChain, stargateChainId)
+}
+
+func (n Networks) Validate() error {
+	if len(n.Chains) == 0 {
+		return errors.New("networks: no chain configured")
+	}
+	if n.Default != "" {
+		if _, ok := n.Chains[n.Default]; !ok {
+			return fmt.Errorf("networks.default: unknown chain %s", n.Default)
+		}
+	}
+	chainIds := make(map[int]string)
+	stargateChainIds := make(map[int]string)
+	for _, key := range n.Names() {
+		chain := n.Chains[key]
+		if chain.Name != key {
+			return fmt.Errorf("networks.%s: name %s does not match key", key, chain.Name)
+		}
+		if err := chain.Validate(); err != nil {
+			return fmt.Errorf("networks.%s: %w", key, err)
+		}
+		if other, ok := chainIds[chain.ChainId]; ok {
+			return fmt.Errorf("networks.%s: chainid %d already used by %s", key, chain.ChainId, other)
+		}
+		chainIds[chain.ChainId] = key
+		if other, ok := stargateChainIds[chain.StargateChainId]; ok {
+			return fmt.Errorf("networks.%s: stargate_chainid %d already used by %s", key, chain.StargateChainId, other)
+		}
+		stargateChainIds[chain.StargateChainId] = key
+	}
+	return nil
+}
+
+// Validate 校验单条链的必填字段
+func (c Chain) Validate() error {
+	if c.ChainId <= 0 {
+		return errors.New("chainid is required")
+	}
+	if c.Rpc == "" && len(c.Rpcs) == 0 {
+		return errors.New("rpc is required")
+	}
+	urls := make(map[string]bool)
+	for i, e := range c.Rpcs {
+		switch {
+		case e.Url == "":
+			return fmt.Errorf("rpcs[%d]: url is required", i)
+		case urls[e.Url]:
+			return fmt.Errorf("rpcs[%d]: duplicate url %s", i, e.Url)
+		case e.Priority < 0:
+			return fmt.Errorf("rpcs[%d]: invalid priority %d", i, e.Priority)
+		case e.Weight < 0:
+			return fmt.Errorf("rpcs[%d]: invalid weight %d", i, e.Weight)
+		}
+		urls[e.Url] = true
+	}
+	if c.RateLimit < 0 || c.RateBurst < 0 {
+		return fmt.Errorf("invalid rate_limit %v rate_burst %d", c.RateLimit, c.RateBurst)
+	}
+	if c.Retry.Attempts < 0 || c.Retry.Backoff < 0 || c.Retry.MaxBackoff < 0 {
+		return errors.New("retry: attempts and backoff should not be negative")
+	}
+	if c.StargateChainId <= 0 || c.StargateChainId > 0xffff {
+		return fmt.Errorf("invalid stargate_chainid %d", c.StargateChainId)
+	}
+	if c.StargetaPoolId <= 0 {
+		return fmt.Errorf("invalid stargate_poolid %d", c.StargetaPoolId)
+	}
+	addresses := []struct {
+		field string
+		value string
+	}{
+		{"stargate_router", c.StargateRouter},
+		{"so_diamond", c.SoDiamond},
+		{"usdc", c.Usdc},
+		{"weth", c.Weth},
+	}
+	for _, item := range addresses {
+		if err := validateAddress(item.field, item.value); err != nil {
+			return err
+		}
+	}
+	if len(c.Swap) == 0 {
+		return errors.New("swap is required")
+	}
+	for i, item := range c.Swap {
+		if len(item) < 2 {
+			return fmt.Errorf("swap[%d]: expected [address, type]", i)
+		}
+		if err := validateAddress(fmt.Sprintf("swap[%d]", i), item[0]); err != nil {
+			return err
+		}
+		switch item[1] {
+		case swapTypeUniswapV2, swapTypeUniswapV2Avax:
+		case swapTypeUniswapV3:
+			if len(item) < 3 {
+				return fmt.Errorf("swap[%d]: %s requires a quoter address", i, item[1])
+			}
+			if err := validateAddress(fmt.Sprintf("swap[%d] quoter", i), item[2]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("swap[%d]: unsupport swap type %s", i, item[1])
+		}
+	}
+	for key, token := range c.Tokens {
+		if err := token.Validate(); err != nil {
+			return fmt.Errorf("tokens.%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (t Token) Validate() error {
+	if !t.Native {
+		if err := validateAddress("address", t.Address); err != nil {
+			return err
+		}
+	} else if !isZeroAddress(t.Address) {
+		return errors.New("native token should not have an address")
+	}
+	if t.Decimals < 0 || t.Decimals > 77 {
+		return fmt.Errorf("invalid decimals %d", t.Decimals)
+	}
+	if t.StargatePoolId < 0 {
+		return fmt.Errorf("invalid stargate_poolid %d", t.StargatePoolId)
+	}
+	if t.Amount != "" {
+		if _, err := decimal.NewFromString(t.Amount); err != nil {
+			return fmt.Errorf("invalid amount %s", t.Amount)
+		}
+	}
+	return nil
+}
+
+func validateAddress(field, address string) error {
+	if address == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("%s: invalid address %s", field, address)
+	}
+	return nil
 }
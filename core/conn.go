@@ -2,25 +2,91 @@ package core
 
 import (
 	"context"
+	"io"
 	"so-omnichain-example/connpool"
-	"sync"
-)
 
-var (
-	conns       map[string]*connpool.EvmConnectPoll
-	connMapLock sync.Mutex
+	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-func init() {
-	conns = make(map[string]*connpool.EvmConnectPoll)
-}
+// defaultPoolSize 每个 rpc 地址默认的最大连接数
+const defaultPoolSize = 2
 
-func getConnectPool(rpcUrl string) *connpool.EvmConnectPoll {
-	connMapLock.Lock()
-	defer connMapLock.Unlock()
-	if p, ok := conns[rpcUrl]; ok {
+// getConnectPool 返回链的连接池，一条链的所有 rpc 地址共用一个连接池
+func (c *Client) getConnectPool(chain Chain) *connpool.EvmConnectPoll {
+	c.connMapLock.Lock()
+	defer c.connMapLock.Unlock()
+	if p, ok := c.conns[chain.Name]; ok {
 		return p
 	}
-	conns[rpcUrl] = connpool.NewEvmConnectPoll(context.Background(), rpcUrl, 2)
-	return conns[rpcUrl]
+	var endpoints []connpool.Endpoint
+	for _, e := range chain.Endpoints() {
+		endpoints = append(endpoints, connpool.Endpoint{Url: e.Url, Priority: e.Priority, Weight: e.Weight})
+	}
+	p := connpool.NewEvmConnectPoll(endpoints, connpool.EvmOptions{
+		MaxConnect: c.poolSize,
+		RateLimit:  chain.RateLimit,
+		RateBurst:  chain.RateBurst,
+		Retry: connpool.RetryPolicy{
+			Attempts:   chain.Retry.Attempts,
+			Backoff:    chain.Retry.Backoff,
+			MaxBackoff: chain.Retry.MaxBackoff,
+		},
+	})
+	if c.closed {
+		// Client 已关闭，返回已关闭的连接池，调用时返回 connpool.ErrPoolClosed
+		p.Close()
+	}
+	c.conns[chain.Name] = p
+	return p
+}
+
+// Close 关闭所有 rpc 连接池，等待进行中的调用结束
+func (c *Client) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown 关闭所有 rpc 连接池及订阅连接：拒绝新的调用，关闭空闲连接，等待进行中的调用结束后关闭其连接
+// ctx 结束时不再等待并返回 ctx 的错误
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.connMapLock.Lock()
+	c.closed = true
+	pools := make([]*connpool.EvmConnectPoll, 0, len(c.conns))
+	for _, p := range c.conns {
+		pools = append(pools, p)
+	}
+	subs := c.subs
+	c.subs = make(map[*ethclient.Client]bool)
+	c.connMapLock.Unlock()
+
+	for client := range subs {
+		client.Close()
+	}
+
+	var err error
+	for _, p := range pools {
+		if shutdownErr := p.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// RpcStats 返回链上每个 rpc 地址的调用次数、出错次数、平均耗时及连接池状态
+func (c *Client) RpcStats(chain string) ([]connpool.EndpointStats, error) {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return nil, err
+	}
+	return c.getConnectPool(chainInfo).EndpointStats(), nil
+}
+
+// WritePrometheus 按 Prometheus 文本格式输出已使用的链的连接池指标
+func (c *Client) WritePrometheus(w io.Writer) error {
+	c.connMapLock.Lock()
+	chains := make(map[string][]connpool.EndpointStats, len(c.conns))
+	for name, p := range c.conns {
+		chains[name] = p.EndpointStats()
+	}
+	c.connMapLock.Unlock()
+	return connpool.WritePrometheus(w, chains)
 }
@@ -4,12 +4,11 @@ import (
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io/fs"
 	"math/big"
-	"os"
 	"strings"
-	"time"
 
-	"github.com/coming-chat/wallet-SDK/core/eth"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -21,6 +20,7 @@ import (
 
 const (
 	methodApprove                     = "approve"
+	methodDecimals                    = "decimals"
 	methodSgReceiveForGas             = "sgReceiveForGas"
 	methodGetStargateFee              = "getStargateFee"
 	methodSoSwapViaStargate           = "soSwapViaStargate"
@@ -43,34 +43,50 @@ const (
 	DataSize = Offset + AddrSize
 )
 
-var (
-	diamondAbi     *abi.ABI
-	erc20Abi       *abi.ABI
-	uniswapEthAbi  *abi.ABI
-	uniswapAvaxAbi *abi.ABI
-	uniswapV3Abi   *abi.ABI
-	quoterAbi      *abi.ABI
-)
+// abiSet 合约 abi 集合，每个 Client 各自加载
+type abiSet struct {
+	diamond     *abi.ABI
+	erc20       *abi.ABI
+	uniswapEth  *abi.ABI
+	uniswapAvax *abi.ABI
+	uniswapV3   *abi.ABI
+	quoter      *abi.ABI
+}
 
-func init() {
-	initAbi(&diamondAbi, "abi/so_diamond.json")
-	initAbi(&erc20Abi, "abi/erc20.json")
-	initAbi(&uniswapEthAbi, "abi/IUniswapV2Router02.json")
-	initAbi(&uniswapAvaxAbi, "abi/IUniswapV2Router02AVAX.json")
-	initAbi(&uniswapV3Abi, "abi/ISwapRouter.json")
-	initAbi(&quoterAbi, "abi/IQuoter.json")
+// loadAbis 从 fsys 根目录加载所有 abi json 文件
+func loadAbis(fsys fs.FS) (*abiSet, error) {
+	abis := &abiSet{}
+	files := []struct {
+		a    **abi.ABI
+		path string
+	}{
+		{&abis.diamond, "so_diamond.json"},
+		{&abis.erc20, "erc20.json"},
+		{&abis.uniswapEth, "IUniswapV2Router02.json"},
+		{&abis.uniswapAvax, "IUniswapV2Router02AVAX.json"},
+		{&abis.uniswapV3, "ISwapRouter.json"},
+		{&abis.quoter, "IQuoter.json"},
+	}
+	for _, file := range files {
+		if err := loadAbi(fsys, file.a, file.path); err != nil {
+			return nil, fmt.Errorf("load abi %s: %w", file.path, err)
+		}
+	}
+	return abis, nil
 }
 
-func initAbi(a **abi.ABI, path string) {
-	file, err := os.Open(path)
+func loadAbi(fsys fs.FS, a **abi.ABI, path string) error {
+	file, err := fsys.Open(path)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 	tmpAbi, err := abi.JSON(file)
-	*a = &tmpAbi
 	if err != nil {
-		panic(err)
+		return err
 	}
+	*a = &tmpAbi
+	return nil
 }
 
 type ExactInputParams struct {
@@ -91,24 +107,24 @@ type DiamondContract struct {
 	baseContract
 }
 
-func newDiamondContract(address common.Address) *DiamondContract {
+func newDiamondContract(abis *abiSet, address common.Address) *DiamondContract {
 	return &DiamondContract{
 		baseContract{
 			Address: address,
-			Abi:     diamondAbi,
+			Abi:     abis.diamond,
 		},
 	}
 }
 
-func (c *DiamondContract) EstimateStargateFinalAmount(client *ethclient.Client, stargateData StargateData, amount *big.Int) (*big.Int, error) {
+func (c *DiamondContract) EstimateStargateFinalAmount(ctx context.Context, client *ethclient.Client, stargateData StargateData, amount *big.Int) (*big.Int, error) {
 	opts := &bind.CallOpts{}
 	msg, err := packInput(c.Abi, opts.From, c.Address, methodEstimateStargateFinalAmount, stargateData, amount)
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.Abi, methodEstimateStargateFinalAmount, resData)
@@ -118,15 +134,15 @@ func (c *DiamondContract) EstimateStargateFinalAmount(client *ethclient.Client,
 	return resp, nil
 }
 
-func (c *DiamondContract) GetSoFee(client *ethclient.Client, amount *big.Int) (*big.Int, error) {
+func (c *DiamondContract) GetSoFee(ctx context.Context, client *ethclient.Client, amount *big.Int) (*big.Int, error) {
 	opts := &bind.CallOpts{}
 	msg, err := packInput(c.Abi, opts.From, c.Address, methodGetSoFee, amount)
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.Abi, methodGetSoFee, resData)
@@ -136,24 +152,25 @@ func (c *DiamondContract) GetSoFee(client *ethclient.Client, amount *big.Int) (*
 	return resp, nil
 }
 
-func (c *DiamondContract) SgReceiveForGas(client *ethclient.Client, soData SoData, stargatePoolId *big.Int, toChainSwapData []SwapData) (uint64, error) {
+func (c *DiamondContract) SgReceiveForGas(ctx context.Context, client *ethclient.Client, soData SoData, stargatePoolId *big.Int, toChainSwapData []SwapData) (uint64, error) {
 	opts := &bind.CallOpts{}
 	msg, err := packInput(c.Abi, opts.From, c.Address, methodSgReceiveForGas, soData, stargatePoolId, toChainSwapData)
 	if err != nil {
 		return 0, err
 	}
-	return bind.ContractTransactor(client).EstimateGas(context.Background(), msg)
+	gas, err := bind.ContractTransactor(client).EstimateGas(ctx, msg)
+	return gas, c.revertError(err)
 }
 
-func (c *DiamondContract) GetAmountBeforeSoFee(client *ethclient.Client, amount *big.Int) (*big.Int, error) {
+func (c *DiamondContract) GetAmountBeforeSoFee(ctx context.Context, client *ethclient.Client, amount *big.Int) (*big.Int, error) {
 	opts := &bind.CallOpts{}
 	msg, err := packInput(c.Abi, opts.From, c.Address, methodGetAmountBeforeSoFee, amount)
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.Abi, methodGetAmountBeforeSoFee, resData)
@@ -163,15 +180,15 @@ func (c *DiamondContract) GetAmountBeforeSoFee(client *ethclient.Client, amount
 	return resp, nil
 }
 
-func (c *DiamondContract) GetStargateFee(client *ethclient.Client, soData SoData, stargateData StargateData, swapDataList []SwapData) (*big.Int, error) {
+func (c *DiamondContract) GetStargateFee(ctx context.Context, client *ethclient.Client, soData SoData, stargateData StargateData, swapDataList []SwapData) (*big.Int, error) {
 	opts := &bind.CallOpts{}
 	msg, err := packInput(c.Abi, opts.From, c.Address, methodGetStargateFee, soData, stargateData, swapDataList)
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.Abi, methodGetStargateFee, resData)
@@ -181,91 +198,53 @@ func (c *DiamondContract) GetStargateFee(client *ethclient.Client, soData SoData
 	return resp, nil
 }
 
-func (c *DiamondContract) SwapTokensGeneric(rpc string,
-	client *ethclient.Client,
-	account *eth.Account,
-	soData SoData,
-	srcSwapDataList []SwapData,
-	value *big.Int) (string, error) {
-	ctx := context.Background()
-	accountAddress := common.HexToAddress(account.Address())
-	opts := &bind.TransactOpts{
-		From: accountAddress,
-	}
-	// 合约参数
-	msg, err := packInput(c.Abi, opts.From, c.Address, methodSwapTokensGeneric, soData, srcSwapDataList)
-	if err != nil {
-		return "", err
-	}
-	// 获取 gas gasprice,构造 tx, encode 成 []byte，使用 account 签名，使用 client 发送
-	// 交易数据由服务端构造，sdk 组装成 tx, marshalBinary 之后交给 wallet-sdk 处理签名 + 发送
-	rawBytes, err := createRawTx(ctx, client, accountAddress, &c.Address, msg, value)
-	if err != nil {
-		return "", err
-	}
-	return signAndSendTx(rawBytes, rpc, account)
+// PackSwapTokensGeneric 构造 swapTokensGeneric 调用数据
+func (c *DiamondContract) PackSwapTokensGeneric(from common.Address, soData SoData, srcSwapDataList []SwapData) (ethereum.CallMsg, error) {
+	return packInput(c.Abi, from, c.Address, methodSwapTokensGeneric, soData, srcSwapDataList)
 }
 
-func (c *DiamondContract) SoSwapViaStargate(rpc string,
-	client *ethclient.Client,
-	account *eth.Account,
+// PackSoSwapViaStargate 构造 soSwapViaStargate 调用数据
+func (c *DiamondContract) PackSoSwapViaStargate(from common.Address,
 	soData SoData,
 	srcSwapDataList []SwapData,
 	stargateData StargateData,
-	dstSwapDataList []SwapData,
-	value *big.Int) (string, error) {
-	ctx := context.Background()
-	accountAddress := common.HexToAddress(account.Address())
-	opts := &bind.TransactOpts{
-		From: accountAddress,
-	}
-	// 合约参数
-	msg, err := packInput(c.Abi, opts.From, c.Address, methodSoSwapViaStargate, soData, srcSwapDataList, stargateData, dstSwapDataList)
-	if err != nil {
-		return "", err
-	}
-	// 获取 gas gasprice,构造 tx, encode 成 []byte，使用 account 签名，使用 client 发送
-	// 交易数据由服务端构造，sdk 组装成 tx, marshalBinary 之后交给 wallet-sdk 处理签名 + 发送
-	rawBytes, err := createRawTx(ctx, client, accountAddress, &c.Address, msg, value)
-	if err != nil {
-		return "", err
-	}
-	return signAndSendTx(rawBytes, rpc, account)
+	dstSwapDataList []SwapData) (ethereum.CallMsg, error) {
+	return packInput(c.Abi, from, c.Address, methodSoSwapViaStargate, soData, srcSwapDataList, stargateData, dstSwapDataList)
 }
 
 type UniswapV2Contract struct {
 	baseContract
 	swapVersion  string
+	abis         *abiSet
 	quoteAbi     *abi.ABI
 	quoteAddress common.Address
 }
 
-func newUnisapV2Contract(address common.Address, swapVersion string, quoterAddress string) *UniswapV2Contract {
+func newUnisapV2Contract(abis *abiSet, address common.Address, swapVersion string, quoterAddress string) *UniswapV2Contract {
 	return &UniswapV2Contract{
 		baseContract: baseContract{
 			Address: address,
-			Abi:     uniswapEthAbi, // 默认使用 eth abi
+			Abi:     abis.uniswapEth, // 默认使用 eth abi
 		},
 		swapVersion:  swapVersion,
-		quoteAbi:     quoterAbi,
+		abis:         abis,
+		quoteAbi:     abis.quoter,
 		quoteAddress: common.HexToAddress(quoterAddress),
 	}
 }
 
-func (c *UniswapV2Contract) PackInput(methodName string, fromAmount, minAmount *big.Int, path []common.Address, to common.Address) (ethereum.CallMsg, error) {
-	swapAbi := uniswapEthAbi
+func (c *UniswapV2Contract) PackInput(methodName string, fromAmount, minAmount *big.Int, path []common.Address, to common.Address, deadline *big.Int) (ethereum.CallMsg, error) {
+	swapAbi := c.abis.uniswapEth
 	if strings.Contains(methodName, "AVAX") {
-		swapAbi = uniswapAvaxAbi
+		swapAbi = c.abis.uniswapAvax
 	}
 
-	deadline := big.NewInt(time.Now().Unix() + 3600)
-
 	if c.swapVersion == versionV3 {
 		pathByte, err := encodePath(path)
 		if err != nil {
 			return ethereum.CallMsg{}, err
 		}
-		return packInput(uniswapV3Abi, common.Address{}, c.Address, methodExactInput, ExactInputParams{
+		return packInput(c.abis.uniswapV3, common.Address{}, c.Address, methodExactInput, ExactInputParams{
 			Path:             pathByte,
 			Recipient:        to,
 			Deadline:         deadline,
@@ -299,9 +278,9 @@ func encodePath(path []common.Address) (encoded []byte, err error) {
 	return
 }
 
-func (c *UniswapV2Contract) GetAmountsIn(client *ethclient.Client, amountOut *big.Int, path []common.Address) ([]*big.Int, error) {
+func (c *UniswapV2Contract) GetAmountsIn(ctx context.Context, client *ethclient.Client, amountOut *big.Int, path []common.Address) ([]*big.Int, error) {
 	if c.swapVersion == versionV3 {
-		return c.quoteExactOutput(client, amountOut, reverseAddress(path))
+		return c.quoteExactOutput(ctx, client, amountOut, reverseAddress(path))
 	}
 
 	opts := &bind.CallOpts{}
@@ -309,9 +288,9 @@ func (c *UniswapV2Contract) GetAmountsIn(client *ethclient.Client, amountOut *bi
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := make([]*big.Int, len(path)-1)
 	err = unpackOutput(&resp, c.Abi, methodGetAmountIn, resData)
@@ -333,7 +312,7 @@ func reverseAddress(s []common.Address) []common.Address {
 	return a
 }
 
-func (c *UniswapV2Contract) quoteExactInput(client *ethclient.Client, amountIn *big.Int, path []common.Address) ([]*big.Int, error) {
+func (c *UniswapV2Contract) quoteExactInput(ctx context.Context, client *ethclient.Client, amountIn *big.Int, path []common.Address) ([]*big.Int, error) {
 	opts := &bind.CallOpts{}
 	pathByte, err := encodePath(path)
 	if err != nil {
@@ -343,9 +322,9 @@ func (c *UniswapV2Contract) quoteExactInput(client *ethclient.Client, amountIn *
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.quoteAbi, methodQuoteExactInput, resData)
@@ -355,7 +334,7 @@ func (c *UniswapV2Contract) quoteExactInput(client *ethclient.Client, amountIn *
 	return []*big.Int{resp}, nil
 }
 
-func (c *UniswapV2Contract) quoteExactOutput(client *ethclient.Client, amountOut *big.Int, path []common.Address) ([]*big.Int, error) {
+func (c *UniswapV2Contract) quoteExactOutput(ctx context.Context, client *ethclient.Client, amountOut *big.Int, path []common.Address) ([]*big.Int, error) {
 	opts := &bind.CallOpts{}
 	pathByte, err := encodePath(path)
 	if err != nil {
@@ -365,9 +344,9 @@ func (c *UniswapV2Contract) quoteExactOutput(client *ethclient.Client, amountOut
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := big.NewInt(0)
 	err = unpackOutput(&resp, c.quoteAbi, methodQuoteExactOutput, resData)
@@ -377,9 +356,9 @@ func (c *UniswapV2Contract) quoteExactOutput(client *ethclient.Client, amountOut
 	return []*big.Int{resp}, nil
 }
 
-func (c *UniswapV2Contract) GetAmountsOut(client *ethclient.Client, amountIn *big.Int, path []common.Address) ([]*big.Int, error) {
+func (c *UniswapV2Contract) GetAmountsOut(ctx context.Context, client *ethclient.Client, amountIn *big.Int, path []common.Address) ([]*big.Int, error) {
 	if c.swapVersion == versionV3 {
-		return c.quoteExactInput(client, amountIn, path)
+		return c.quoteExactInput(ctx, client, amountIn, path)
 	}
 
 	opts := &bind.CallOpts{}
@@ -387,9 +366,9 @@ func (c *UniswapV2Contract) GetAmountsOut(client *ethclient.Client, amountIn *bi
 	if err != nil {
 		return nil, err
 	}
-	resData, err := bind.ContractCaller(client).CallContract(context.Background(), msg, opts.BlockNumber)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return nil, err
+		return nil, c.revertError(err)
 	}
 	resp := make([]*big.Int, len(path)-1)
 	err = unpackOutput(&resp, c.Abi, methodGetAmountsOut, resData)
@@ -403,115 +382,82 @@ type Erc20Contract struct {
 	baseContract
 }
 
-func newErc20Contract(address common.Address) *Erc20Contract {
+func newErc20Contract(abis *abiSet, address common.Address) *Erc20Contract {
 	return &Erc20Contract{
 		baseContract{
 			Address: address,
-			Abi:     erc20Abi,
+			Abi:     abis.erc20,
 		},
 	}
 }
 
-func (c *Erc20Contract) Approve(rpc string, client *ethclient.Client, account *eth.Account, approveTo common.Address, amount *big.Int) (string, error) {
-	ctx := context.Background()
-	accountAddress := common.HexToAddress(account.Address())
-	opts := &bind.TransactOpts{
-		From: accountAddress,
+func (c *Erc20Contract) Decimals(ctx context.Context, client *ethclient.Client) (uint8, error) {
+	opts := &bind.CallOpts{}
+	msg, err := packInput(c.Abi, opts.From, c.Address, methodDecimals)
+	if err != nil {
+		return 0, err
 	}
-	// 向 so diamond 合约 approve erc20 token
-	msg, err := packInput(c.Abi, opts.From, c.Address, methodApprove, approveTo, amount)
+	resData, err := bind.ContractCaller(client).CallContract(ctx, msg, opts.BlockNumber)
 	if err != nil {
-		return "", err
+		return 0, c.revertError(err)
 	}
-	// 获取 gas gasprice,构造 tx, encode 成 []byte，使用 account 签名，使用 client 发送
-	// 交易数据由服务端构造，sdk 组装成 tx, marshalBinary 之后交给 wallet-sdk 处理签名 + 发送
-	rawBytes, err := createRawTx(ctx, client, accountAddress, &c.Address, msg, big.NewInt(0))
+	var resp uint8
+	err = unpackOutput(&resp, c.Abi, methodDecimals, resData)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
-	return signAndSendTx(rawBytes, rpc, account)
+	return resp, nil
 }
 
-func signAndSendTx(rawBytes []byte, rpc string, account *eth.Account) (string, error) {
-	wallet := eth.NewChainWithRpc(rpc)
-	privateKeyHex, err := account.PrivateKeyHex()
-	if err != nil {
-		return "", err
-	}
-	tx, err := eth.NewTransactionFromHex(hex.EncodeToString(rawBytes))
-	if err != nil {
-		return "", err
-	}
-	signedTx, err := wallet.SignTransaction(privateKeyHex, tx)
-	if err != nil {
-		return "", err
-	}
-	sendTxResult, err := wallet.SendRawTransaction(signedTx.Value)
-	if err != nil {
-		return "", err
-	}
-	return sendTxResult, nil
+// PackApprove 构造 approve 调用数据
+func (c *Erc20Contract) PackApprove(from common.Address, approveTo common.Address, amount *big.Int) (ethereum.CallMsg, error) {
+	return packInput(c.Abi, from, c.Address, methodApprove, approveTo, amount)
 }
 
-func createRawTx(ctx context.Context,
+// txOptions 构造交易的可选参数
+type txOptions struct {
+	nonce    *uint64 // 为空时使用 PendingNonceAt
+	gasLimit uint64  // 为 0 时通过 EstimateGas 预估
+}
+
+func createRawTxWithOptions(ctx context.Context,
 	client *ethclient.Client,
 	accountAddress common.Address,
 	contract *common.Address,
 	msg ethereum.CallMsg,
-	value *big.Int) ([]byte, error) {
-	// 获取 gas gasprice,构造 tx, encode 成 []byte，使用 account 签名，使用 client 发送
-	// 交易数据由服务端构造，sdk 组装成 tx, marshalBinary 之后交给 wallet-sdk 处理签名 + 发送
-	nonce, err := client.PendingNonceAt(ctx, accountAddress) // 由  signer 实现
-	if err != nil {
-		return nil, err
-	}
-	msg.Value = value
-	estimateGas, err := client.EstimateGas(ctx, msg)
+	value *big.Int,
+	txOpts txOptions) (*types.Transaction, error) {
+	// 获取 chain id、nonce、gas、gasprice，构造未签名的 tx，由 signer 签名
+	chainId, err := client.ChainID(ctx)
 	if err != nil {
 		return nil, err
 	}
-	gasLimit := uint64(float64(estimateGas) * 5)
-
-	var (
-		maxPriorityFee *big.Int
-		maxFee         *big.Int
-	)
-	priorityRate := 1.5
-	maxFeeRate := 1.1
-	// base fee
-	header, err := client.HeaderByNumber(ctx, big.NewInt(-1))
-	if err != nil || header.BaseFee == nil {
-		var gasPrice *big.Int
-		gasPrice, err = client.SuggestGasPrice(ctx)
+	var nonce uint64
+	if txOpts.nonce != nil {
+		nonce = *txOpts.nonce
+	} else {
+		nonce, err = client.PendingNonceAt(ctx, accountAddress)
 		if err != nil {
 			return nil, err
 		}
-		maxPriorityFee = decimal.NewFromBigInt(gasPrice, 0).Mul(decimal.NewFromFloat(maxFeeRate)).BigInt()
-		maxFee = maxPriorityFee
-	} else {
-		// tip fee
-		priorityFee, err := client.SuggestGasTipCap(ctx) // GasFeeCap maxFeePerGas
+	}
+	msg.Value = value
+	gasLimit := txOpts.gasLimit
+	if gasLimit == 0 {
+		estimateGas, err := client.EstimateGas(ctx, msg)
 		if err != nil {
 			return nil, err
 		}
-
-		// MaxPriorityFee = SuggestPriorityFee * priorityRate
-		// MaxFee = (MaxPriorityFee + BaseFee) * maxFeeRate
-		maxPriorityFee = decimal.NewFromBigInt(priorityFee, 0).Mul(decimal.NewFromFloat(priorityRate)).BigInt()
-		maxFee = decimal.NewFromBigInt(big.NewInt(0).Add(maxPriorityFee, header.BaseFee), 0).Mul(decimal.NewFromFloat(maxFeeRate)).BigInt()
+		gasLimit = uint64(float64(estimateGas) * 5)
 	}
 
+	maxPriorityFee, maxFee, err := suggestFees(ctx, client)
 	if err != nil {
-		errInfo := err.Error()
-		// 尽管用户的余额不够，也需要返回可兑换的结果，用户最后执行的时候会再 estimateGas，那时候会失败
-		if strings.Contains(errInfo, "insufficient funds for transfer") {
-			err = nil
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	rawTx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainId,
 		Nonce:     nonce,
 		To:        contract,
 		Value:     value,
@@ -520,7 +466,34 @@ func createRawTx(ctx context.Context,
 		GasTipCap: maxPriorityFee,
 		Data:      msg.Data,
 	})
-	return rawTx.MarshalBinary()
+	return rawTx, nil
+}
+
+// suggestFees 按当前 base fee 及建议的 tip 计算 GasTipCap、GasFeeCap，链不支持 EIP-1559 时两者都使用 gas price
+func suggestFees(ctx context.Context, client *ethclient.Client) (maxPriorityFee, maxFee *big.Int, err error) {
+	priorityRate := 1.5
+	maxFeeRate := 1.1
+	// base fee
+	header, err := client.HeaderByNumber(ctx, big.NewInt(-1))
+	if err != nil || header.BaseFee == nil {
+		gasPrice, err := client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		maxPriorityFee = decimal.NewFromBigInt(gasPrice, 0).Mul(decimal.NewFromFloat(maxFeeRate)).BigInt()
+		return maxPriorityFee, maxPriorityFee, nil
+	}
+	// tip fee
+	priorityFee, err := client.SuggestGasTipCap(ctx) // GasFeeCap maxFeePerGas
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// MaxPriorityFee = SuggestPriorityFee * priorityRate
+	// MaxFee = (MaxPriorityFee + BaseFee) * maxFeeRate
+	maxPriorityFee = decimal.NewFromBigInt(priorityFee, 0).Mul(decimal.NewFromFloat(priorityRate)).BigInt()
+	maxFee = decimal.NewFromBigInt(big.NewInt(0).Add(maxPriorityFee, header.BaseFee), 0).Mul(decimal.NewFromFloat(maxFeeRate)).BigInt()
+	return maxPriorityFee, maxFee, nil
 }
 
 func packInput(pabi *abi.ABI, from, toContract common.Address, methodName string, args ...interface{}) (ethereum.CallMsg, error) {
@@ -551,3 +524,22 @@ func unpackOutput(out interface{}, pabi *abi.ABI, methodName string, resData []b
 	}
 	return nil
 }
+
+// unpackInput 根据 calldata 的 method id 找到 pabi 中的方法，并把参数解析到 out
+func unpackInput(out interface{}, pabi *abi.ABI, data []byte) (*abi.Method, error) {
+	if len(data) < 4 {
+		return nil, errors.New("calldata too short")
+	}
+	method, err := pabi.MethodById(data[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return method, err
+	}
+	if err = method.Inputs.Copy(out, args); err != nil {
+		return method, err
+	}
+	return method, nil
+}
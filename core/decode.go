@@ -0,0 +1,239 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DecodedCall 根据 abi 解析出的合约调用
+type DecodedCall struct {
+	Contract  string // abi 文件名，如 so_diamond.json
+	Method    string
+	Signature string
+	Args      []DecodedArg
+}
+
+// DecodedArg 解析后的参数，SoData、SwapData、StargateData、ExactInputParams 会转换成对应的类型
+// SwapData 的 CallData 能解析时，解析结果按下标放在 Calls 中
+type DecodedArg struct {
+	Name  string
+	Type  string
+	Value interface{}
+	Calls []*DecodedCall
+}
+
+// decodeAbi 参与解析的 abi，同一个 method id 按顺序取第一个
+type decodeAbi struct {
+	name string
+	abi  *abi.ABI
+}
+
+func (a *abiSet) decodeAbis() []decodeAbi {
+	return []decodeAbi{
+		{"so_diamond.json", a.diamond},
+		{"erc20.json", a.erc20},
+		{"IUniswapV2Router02.json", a.uniswapEth},
+		{"IUniswapV2Router02AVAX.json", a.uniswapAvax},
+		{"ISwapRouter.json", a.uniswapV3},
+		{"IQuoter.json", a.quoter},
+	}
+}
+
+// tupleTypes abi struct 名称后缀对应的 go 类型，如 ISo.SoData、LibSwap.SwapData
+var tupleTypes = map[string]reflect.Type{
+	"SoData":           reflect.TypeOf(SoData{}),
+	"SwapData":         reflect.TypeOf(SwapData{}),
+	"StargateData":     reflect.TypeOf(StargateData{}),
+	"ExactInputParams": reflect.TypeOf(ExactInputParams{}),
+}
+
+// DecodeCalldata 在所有 abi 中查找 calldata 的方法并解析参数，SwapData 中的 swap calldata 会递归解析
+func (c *Client) DecodeCalldata(data []byte) (*DecodedCall, error) {
+	if len(data) < 4 {
+		return nil, errors.New("calldata too short")
+	}
+	for _, a := range c.abis.decodeAbis() {
+		method, err := a.abi.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		values, err := method.Inputs.Unpack(data[4:])
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", a.name, method.Sig, err)
+		}
+		call := &DecodedCall{
+			Contract:  a.name,
+			Method:    method.Name,
+			Signature: method.Sig,
+		}
+		for i, input := range method.Inputs {
+			call.Args = append(call.Args, c.decodeArg(input, values[i]))
+		}
+		return call, nil
+	}
+	return nil, fmt.Errorf("%w: unknown method id 0x%x", errUnsupportMethod, data[:4])
+}
+
+// DecodeTx 解析交易的 calldata，chain 为空时在所有配置的链上查找交易
+func (c *Client) DecodeTx(ctx context.Context, chain string, txHash string) (*DecodedCall, error) {
+	_, tx, err := c.findTx(ctx, chain, common.HexToHash(txHash))
+	if err != nil {
+		return nil, err
+	}
+	return c.DecodeCalldata(tx.Data())
+}
+
+func (c *Client) decodeArg(input abi.Argument, value interface{}) DecodedArg {
+	arg := DecodedArg{
+		Name:  input.Name,
+		Type:  input.Type.String(),
+		Value: convertTuple(input.Type, value),
+	}
+	var swapData []SwapData
+	switch v := arg.Value.(type) {
+	case SwapData:
+		swapData = []SwapData{v}
+	case []SwapData:
+		swapData = v
+	}
+	if len(swapData) > 0 {
+		arg.Calls = make([]*DecodedCall, len(swapData))
+		for i, item := range swapData {
+			// 解析失败时保留原始 calldata
+			arg.Calls[i], _ = c.DecodeCalldata(item.CallData)
+		}
+	}
+	return arg
+}
+
+// convertTuple 把 abi 解析出的匿名 struct 转换成 tupleTypes 中对应的类型，未知的类型原样返回
+func convertTuple(typ abi.Type, value interface{}) (result interface{}) {
+	elem := &typ
+	if typ.T == abi.SliceTy || typ.T == abi.ArrayTy {
+		elem = typ.Elem
+	}
+	if elem.T != abi.TupleTy {
+		return value
+	}
+	var target reflect.Type
+	for suffix, t := range tupleTypes {
+		if strings.HasSuffix(elem.TupleRawName, suffix) {
+			target = t
+			break
+		}
+	}
+	if target == nil {
+		return value
+	}
+	if elem != &typ {
+		target = reflect.SliceOf(target)
+	}
+	// abi.ConvertType 字段不匹配时会 panic，此时返回原始值
+	defer func() {
+		if recover() != nil {
+			result = value
+		}
+	}()
+	return reflect.ValueOf(abi.ConvertType(value, reflect.New(target).Interface())).Elem().Interface()
+}
+
+func (d *DecodedCall) String() string {
+	var b strings.Builder
+	d.write(&b, 0)
+	return b.String()
+}
+
+func (d *DecodedCall) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(b, "%s%s %s\n", indent, d.Contract, d.Signature)
+	for _, arg := range d.Args {
+		fmt.Fprintf(b, "%s  %s (%s):\n", indent, arg.Name, arg.Type)
+		writeValue(b, depth+2, arg.Value, arg.Calls)
+	}
+}
+
+// writeValue 按类型输出参数，SwapData 后面输出解析出的 swap calldata
+func writeValue(b *strings.Builder, depth int, value interface{}, calls []*DecodedCall) {
+	indent := strings.Repeat("  ", depth)
+	field := func(name string, v interface{}) {
+		fmt.Fprintf(b, "%s%-20s %v\n", indent, name+":", v)
+	}
+	switch v := value.(type) {
+	case SoData:
+		field("transactionId", common.Hash(v.TransactionId).Hex())
+		field("receiver", v.Receiver.Hex())
+		field("sourceChainId", v.SourceChainId)
+		field("sendingAssetId", v.SendingAssetId.Hex())
+		field("destinationChainId", v.DestinationChainId)
+		field("receivingAssetId", v.ReceivingAssetId.Hex())
+		field("amount", v.Amount)
+	case SwapData:
+		field("callTo", v.CallTo.Hex())
+		field("approveTo", v.ApproveTo.Hex())
+		field("sendingAssetId", v.SendingAssetId.Hex())
+		field("receivingAssetId", v.ReceivingAssetId.Hex())
+		field("fromAmount", v.FromAmount)
+		if len(calls) > 0 && calls[0] != nil {
+			fmt.Fprintf(b, "%scallData:\n", indent)
+			calls[0].write(b, depth+1)
+		} else {
+			field("callData", "0x"+hex.EncodeToString(v.CallData))
+		}
+	case []SwapData:
+		for i, item := range v {
+			fmt.Fprintf(b, "%s[%d]\n", indent, i)
+			var call []*DecodedCall
+			if i < len(calls) {
+				call = calls[i : i+1]
+			}
+			writeValue(b, depth+1, item, call)
+		}
+	case StargateData:
+		field("srcStargatePoolId", v.SrcStargatePoolId)
+		field("dstStargateChainId", v.DstStargateChainId)
+		field("dstStargatePoolId", v.DstStargatePoolId)
+		field("minAmount", v.MinAmount)
+		field("dstGasForSgReceive", v.DstGasForSgReceive)
+		field("dstSoDiamond", v.DstSoDiamond.Hex())
+	case ExactInputParams:
+		field("path", formatV3Path(v.Path))
+		field("recipient", v.Recipient.Hex())
+		field("deadline", v.Deadline)
+		field("amountIn", v.AmountIn)
+		field("amountOutMinimum", v.AmountOutMinimum)
+	case []common.Address:
+		for i, address := range v {
+			fmt.Fprintf(b, "%s[%d] %s\n", indent, i, address.Hex())
+		}
+	case common.Address:
+		fmt.Fprintf(b, "%s%s\n", indent, v.Hex())
+	case []byte:
+		fmt.Fprintf(b, "%s0x%s\n", indent, hex.EncodeToString(v))
+	case [32]byte:
+		fmt.Fprintf(b, "%s%s\n", indent, common.Hash(v).Hex())
+	default:
+		fmt.Fprintf(b, "%s%v\n", indent, v)
+	}
+}
+
+// formatV3Path 解析 uniswap v3 path：token(20 字节) fee(3 字节) token ...
+func formatV3Path(path []byte) string {
+	if len(path) < AddrSize || (len(path)-AddrSize)%Offset != 0 {
+		return "0x" + hex.EncodeToString(path)
+	}
+	var b strings.Builder
+	b.WriteString(common.BytesToAddress(path[:AddrSize]).Hex())
+	for i := AddrSize; i < len(path); i += Offset {
+		fee := new(big.Int).SetBytes(path[i : i+FeeSize])
+		fmt.Fprintf(&b, " -(%s)-> %s", fee, common.BytesToAddress(path[i+FeeSize:i+Offset]).Hex())
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestDecodeCalldataRoundTrip(t *testing.T) {
+	abis := testAbis(t)
+	c := &Client{abis: abis}
+
+	usdc := common.HexToAddress("0x1717A0D5C8705EE89A8aD6E808268D6A826C97A4")
+	weth := common.HexToAddress("0xc778417E063141139Fce010982780140Aa0cD5Ab")
+	dai := common.HexToAddress("0x5592EC0cfb4dbc12D3aB100b257153436a1f0FEa")
+	diamond := common.HexToAddress("0x7E88c5E7134E4589F6316636CA8Fe8Cc9f8ED505")
+	router := common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	v3Router := common.HexToAddress("0xE592427A0AEce92De3Edee1F18E0157C05861564")
+
+	// 源链 uniswap v2 swap
+	v2Path := []common.Address{weth, usdc}
+	v2Call, err := abis.uniswapEth.Pack("swapExactTokensForTokens", big.NewInt(1e16), big.NewInt(9e6), v2Path, diamond, big.NewInt(1700000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 目标链 uniswap v3 swap，path 为 usdc -(500)-> weth -(3000)-> dai
+	v3Path := append(append(append(append(usdc.Bytes(), 0x00, 0x01, 0xf4), weth.Bytes()...), 0x00, 0x0b, 0xb8), dai.Bytes()...)
+	v3Params := ExactInputParams{
+		Path:             v3Path,
+		Recipient:        diamond,
+		Deadline:         big.NewInt(1700000000),
+		AmountIn:         big.NewInt(9e6),
+		AmountOutMinimum: big.NewInt(8e18),
+	}
+	v3Call, err := abis.uniswapV3.Pack("exactInput", v3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	soData := SoData{
+		TransactionId:      [32]byte{1, 2, 3},
+		Receiver:           common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"),
+		SourceChainId:      big.NewInt(4),
+		SendingAssetId:     common.Address{},
+		DestinationChainId: big.NewInt(43113),
+		ReceivingAssetId:   dai,
+		Amount:             big.NewInt(1e16),
+	}
+	srcSwap := []SwapData{{CallTo: router, ApproveTo: router, SendingAssetId: weth, ReceivingAssetId: usdc, FromAmount: big.NewInt(1e16), CallData: v2Call}}
+	stargateData := StargateData{
+		SrcStargatePoolId:  big.NewInt(1),
+		DstStargateChainId: 10006,
+		DstStargatePoolId:  big.NewInt(1),
+		MinAmount:          big.NewInt(8900000),
+		DstGasForSgReceive: big.NewInt(250000),
+		DstSoDiamond:       common.HexToAddress("0x7b74Ea20a1e2003F305c4adcD61Df1A72A38e50b"),
+	}
+	dstSwap := []SwapData{{CallTo: v3Router, ApproveTo: v3Router, SendingAssetId: usdc, ReceivingAssetId: dai, FromAmount: big.NewInt(9e6), CallData: v3Call}}
+	data, err := abis.diamond.Pack(methodSoSwapViaStargate, soData, srcSwap, stargateData, dstSwap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call, err := c.DecodeCalldata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.Contract != "so_diamond.json" || call.Method != methodSoSwapViaStargate || len(call.Args) != 4 {
+		t.Fatalf("decoded %s %s with %d args", call.Contract, call.Method, len(call.Args))
+	}
+	if got, ok := call.Args[0].Value.(SoData); !ok || !reflect.DeepEqual(got, soData) {
+		t.Fatalf("SoData = %#v, want %#v", call.Args[0].Value, soData)
+	}
+	if got, ok := call.Args[1].Value.([]SwapData); !ok || !reflect.DeepEqual(got, srcSwap) {
+		t.Fatalf("source SwapData = %#v", call.Args[1].Value)
+	}
+	if got, ok := call.Args[2].Value.(StargateData); !ok || !reflect.DeepEqual(got, stargateData) {
+		t.Fatalf("StargateData = %#v, want %#v", call.Args[2].Value, stargateData)
+	}
+	if got, ok := call.Args[3].Value.([]SwapData); !ok || !reflect.DeepEqual(got, dstSwap) {
+		t.Fatalf("destination SwapData = %#v", call.Args[3].Value)
+	}
+
+	// 源链 v2 swap calldata 递归解析
+	if len(call.Args[1].Calls) != 1 || call.Args[1].Calls[0] == nil {
+		t.Fatal("source swap calldata not decoded")
+	}
+	v2 := call.Args[1].Calls[0]
+	if v2.Method != "swapExactTokensForTokens" {
+		t.Fatalf("source swap method %s", v2.Method)
+	}
+	if path, ok := v2.Args[2].Value.([]common.Address); !ok || !reflect.DeepEqual(path, v2Path) {
+		t.Fatalf("v2 path = %v, want %v", v2.Args[2].Value, v2Path)
+	}
+
+	// 目标链 v3 swap calldata 递归解析，参数转换成 ExactInputParams
+	if len(call.Args[3].Calls) != 1 || call.Args[3].Calls[0] == nil {
+		t.Fatal("destination swap calldata not decoded")
+	}
+	v3 := call.Args[3].Calls[0]
+	params, ok := v3.Args[0].Value.(ExactInputParams)
+	if !ok || !reflect.DeepEqual(params, v3Params) {
+		t.Fatalf("v3 params = %#v, want %#v", v3.Args[0].Value, v3Params)
+	}
+	wantPath := usdc.Hex() + " -(500)-> " + weth.Hex() + " -(3000)-> " + dai.Hex()
+	if got := formatV3Path(params.Path); got != wantPath {
+		t.Fatalf("v3 path = %s, want %s", got, wantPath)
+	}
+	if out := call.String(); !strings.Contains(out, wantPath) || !strings.Contains(out, "swapExactTokensForTokens") {
+		t.Fatalf("String() misses the nested calls:\n%s", out)
+	}
+}
+
+func TestDecodeCalldataInvalid(t *testing.T) {
+	abis := testAbis(t)
+	c := &Client{abis: abis}
+
+	if _, err := c.DecodeCalldata([]byte{0x12, 0x34}); err == nil {
+		t.Fatal("calldata shorter than a method id decoded")
+	}
+	if _, err := c.DecodeCalldata([]byte{0xde, 0xad, 0xbe, 0xef, 0x00}); !errors.Is(err, errUnsupportMethod) {
+		t.Fatalf("unknown method id err = %v, want errUnsupportMethod", err)
+	}
+
+	data, err := abis.erc20.Pack("approve", common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"), big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.DecodeCalldata(data[:len(data)-10]); err == nil {
+		t.Fatal("truncated calldata decoded")
+	}
+
+	// SwapData 中无法解析的 calldata 保留原始数据
+	swap := []SwapData{{FromAmount: big.NewInt(1), CallData: []byte{0xde, 0xad, 0xbe, 0xef}}}
+	data, err = abis.diamond.Pack(methodSwapTokensGeneric, SoData{
+		SourceChainId: big.NewInt(4), DestinationChainId: big.NewInt(4), Amount: big.NewInt(1),
+	}, swap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call, err := c.DecodeCalldata(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(call.Args[1].Calls) != 1 || call.Args[1].Calls[0] != nil {
+		t.Fatalf("undecodable swap calldata: %+v", call.Args[1].Calls)
+	}
+	if !strings.Contains(call.String(), "0xdeadbeef") {
+		t.Fatalf("raw calldata missing from output:\n%s", call)
+	}
+}
@@ -6,4 +6,5 @@ var (
 	errUnsupportChain  = errors.New("unsupport chain")
 	errUnsupportToken  = errors.New("unsupport token")
 	errUnsupportMethod = errors.New("unsupport method")
+	errNoAccount       = errors.New("no account configured")
 )
@@ -0,0 +1,311 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	txKindApprove = "approve"
+	txKindSwap    = "swap"
+
+	// exportSwapGasLimit 需要先 approve 时，swap 交易在 approve 上链前无法预估 gas，使用此默认值
+	exportSwapGasLimit = 1500000
+
+	bundleFileName = "bundle.json"
+)
+
+// ExportOptions 导出未签名交易的参数
+type ExportOptions struct {
+	From     common.Address // 发送交易的账户
+	GasLimit uint64         // swap 交易的 gas limit，为 0 时自动预估，无法预估时使用默认值
+}
+
+// TxBundle 一次 swap 需要发送的全部未签名交易，按 nonce 顺序排列
+type TxBundle struct {
+	Chain   string         `json:"chain"`
+	ChainId int            `json:"chainId"`
+	From    common.Address `json:"from"`
+	Quote   *Quote         `json:"-"`
+	Txs     []*BundleTx    `json:"txs"`
+}
+
+// BundleTx 未签名交易，Unsigned 为 EIP-2718 编码的未签名交易，签名后填入 Signed
+type BundleTx struct {
+	Kind     string             `json:"kind"`
+	Unsigned hexutil.Bytes      `json:"unsigned"`
+	Tx       *types.Transaction `json:"tx"`
+	Signed   hexutil.Bytes      `json:"signed,omitempty"`
+}
+
+// ExportSwap 完成 swap 的预估并构造 approve 及 swap 的未签名交易，不签名也不发送
+func (c *Client) ExportSwap(ctx context.Context, req SwapRequest, opts ExportOptions) (*TxBundle, error) {
+	if opts.From == (common.Address{}) {
+		return nil, errors.New("export requires the from address")
+	}
+	if req.Receiver == "" {
+		req.Receiver = opts.From.Hex()
+	}
+	req, sameChain, err := c.resolveRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var route *swapRoute
+	if sameChain {
+		route, err = c.planSameChain(ctx, req)
+	} else {
+		route, err = c.planDiffChain(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if route == nil {
+		return nil, fmt.Errorf("nothing to swap: %s to %s", req.FromToken, req.ToToken)
+	}
+
+	chainInfo := route.fromChain
+	fromTokenInfo := route.quote.FromToken
+	bundle := &TxBundle{
+		Chain:   chainInfo.Name,
+		ChainId: chainInfo.ChainId,
+		From:    opts.From,
+		Quote:   &route.quote,
+	}
+	diamond := newDiamondContract(c.abis, common.HexToAddress(chainInfo.SoDiamond))
+	pool := c.getConnectPool(chainInfo)
+	// 只预估不发送交易，出错重试时重新构造所有交易
+	err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		bundle.Txs = nil
+		nonce, err := c1.PendingNonceAt(ctx, opts.From)
+		if err != nil {
+			return err
+		}
+		swapGasLimit := opts.GasLimit
+
+		// 1. 如果 from token 是 erc20，需要先 approve
+		if !fromTokenInfo.Native {
+			msg, err := newErc20Contract(c.abis, common.HexToAddress(fromTokenInfo.Address)).
+				PackApprove(opts.From, diamond.Address, route.quote.AmountIn)
+			if err != nil {
+				return err
+			}
+			if err = bundle.add(ctx, c1, txKindApprove, msg, big.NewInt(0), txOptions{nonce: &nonce}); err != nil {
+				return err
+			}
+			nonce++
+			if swapGasLimit == 0 {
+				swapGasLimit = exportSwapGasLimit
+			}
+		}
+
+		// 2. swap 交易
+		var msg ethereum.CallMsg
+		if route.toChain.Name == chainInfo.Name {
+			msg, err = diamond.PackSwapTokensGeneric(opts.From, route.soData, route.srcSwapData)
+		} else {
+			msg, err = diamond.PackSoSwapViaStargate(opts.From, route.soData, route.srcSwapData, route.stargateData, route.dstSwapData)
+		}
+		if err != nil {
+			return err
+		}
+		return bundle.add(ctx, c1, txKindSwap, msg, route.quote.Value, txOptions{nonce: &nonce, gasLimit: swapGasLimit})
+	})
+	if err != nil {
+		return nil, revertError(err, c.abis.diamond, c.abis.erc20)
+	}
+	return bundle, nil
+}
+
+func (b *TxBundle) add(ctx context.Context, client *ethclient.Client, kind string, msg ethereum.CallMsg, value *big.Int, txOpts txOptions) error {
+	rawTx, err := createRawTxWithOptions(ctx, client, b.From, msg.To, msg, value, txOpts)
+	if err != nil {
+		return fmt.Errorf("create %s tx: %w", kind, err)
+	}
+	unsigned, err := rawTx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	b.Txs = append(b.Txs, &BundleTx{
+		Kind:     kind,
+		Unsigned: unsigned,
+		Tx:       rawTx,
+	})
+	return nil
+}
+
+// WriteFiles 把 bundle 写入 dir，bundle.json 包含全部交易，另外每笔交易单独写一个 hex 编码的 .rlp 文件
+// 返回写入的文件路径
+func (b *TxBundle) WriteFiles(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, bundleFileName)
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		return nil, err
+	}
+	paths := []string{path}
+	for i, tx := range b.Txs {
+		path = filepath.Join(dir, fmt.Sprintf("%02d-%s.rlp", i+1, tx.Kind))
+		if err = os.WriteFile(path, []byte(tx.Unsigned.String()+"\n"), 0o644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// LoadSignedTxs 读取签名后的交易，文件可以是填好 signed 字段的 bundle.json，也可以是 hex 编码的原始交易
+// bundle.json 中的签名交易必须与导出的未签名交易一致且由 from 账户签名，防止签名时交易被篡改
+// 按文件顺序返回
+func LoadSignedTxs(paths ...string) ([]*types.Transaction, error) {
+	var txs []*types.Transaction
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content := strings.TrimSpace(string(data))
+		if strings.HasPrefix(content, "{") {
+			var bundle TxBundle
+			if err = json.Unmarshal(data, &bundle); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			for _, bundleTx := range bundle.Txs {
+				if len(bundleTx.Signed) == 0 {
+					return nil, fmt.Errorf("%s: %s tx is not signed", path, bundleTx.Kind)
+				}
+				tx, err := decodeSignedTx(bundleTx.Signed)
+				if err == nil {
+					err = bundleTx.verifySigned(bundle.From, tx)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s tx: %w", path, bundleTx.Kind, err)
+				}
+				txs = append(txs, tx)
+			}
+			continue
+		}
+		raw, err := hexutil.Decode(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		tx, err := decodeSignedTx(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func decodeSignedTx(raw []byte) (*types.Transaction, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	if v, r, s := tx.RawSignatureValues(); v.Sign() == 0 && r.Sign() == 0 && s.Sign() == 0 {
+		return nil, errors.New("transaction is not signed")
+	}
+	return tx, nil
+}
+
+// verifySigned 检查签名后的交易与导出的未签名交易的签名 hash 一致，且签名账户为 from
+func (t *BundleTx) verifySigned(from common.Address, signed *types.Transaction) error {
+	exported := t.Tx
+	if len(t.Unsigned) > 0 {
+		exported = new(types.Transaction)
+		if err := exported.UnmarshalBinary(t.Unsigned); err != nil {
+			return fmt.Errorf("decode unsigned tx: %w", err)
+		}
+	}
+	if exported == nil {
+		return errors.New("no exported tx to verify the signed tx against")
+	}
+	// 签名 hash 使用 txSigner 的 chain id 计算，交易本身的 chain id 需要单独比较
+	txSigner := types.LatestSignerForChainID(exported.ChainId())
+	if signed.ChainId().Cmp(exported.ChainId()) != 0 || txSigner.Hash(signed) != txSigner.Hash(exported) {
+		return fmt.Errorf("signed tx does not match the exported tx, %s differ", strings.Join(txDiff(exported, signed), ", "))
+	}
+	sender, err := types.Sender(txSigner, signed)
+	if err != nil {
+		return err
+	}
+	if sender != from {
+		return fmt.Errorf("tx signed by %s, expected %s", sender.Hex(), from.Hex())
+	}
+	return nil
+}
+
+// txDiff 返回两笔交易不同的字段名
+func txDiff(a, b *types.Transaction) []string {
+	var fields []string
+	add := func(name string, differ bool) {
+		if differ {
+			fields = append(fields, name)
+		}
+	}
+	addressOf := func(to *common.Address) common.Address {
+		if to == nil {
+			return common.Address{}
+		}
+		return *to
+	}
+	add("type", a.Type() != b.Type())
+	add("chainId", a.ChainId().Cmp(b.ChainId()) != 0)
+	add("nonce", a.Nonce() != b.Nonce())
+	add("to", (a.To() == nil) != (b.To() == nil) || addressOf(a.To()) != addressOf(b.To()))
+	add("value", a.Value().Cmp(b.Value()) != 0)
+	add("data", !bytes.Equal(a.Data(), b.Data()))
+	add("gas", a.Gas() != b.Gas())
+	add("gasTipCap", a.GasTipCap().Cmp(b.GasTipCap()) != 0)
+	add("gasFeeCap", a.GasFeeCap().Cmp(b.GasFeeCap()) != 0)
+	if len(fields) == 0 {
+		fields = append(fields, "accessList")
+	}
+	return fields
+}
+
+// Broadcast 按顺序发送外部签名后的交易，每笔交易上链成功后再发送下一笔
+func (c *Client) Broadcast(ctx context.Context, chain string, txs []*types.Transaction) ([]string, error) {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return nil, err
+	}
+	chainId := big.NewInt(int64(chainInfo.ChainId))
+	for _, tx := range txs {
+		if tx.ChainId().Cmp(chainId) != 0 {
+			return nil, fmt.Errorf("tx %s chain id %s, expected %s", tx.Hash().Hex(), tx.ChainId(), chainId)
+		}
+	}
+	hashes := make([]string, 0, len(txs))
+	for _, tx := range txs {
+		if err = c.sendSignedTx(ctx, chainInfo, tx); err != nil {
+			return hashes, err
+		}
+		txHash := tx.Hash().Hex()
+		c.logger.Printf("txHash: %s\n", txHash)
+		hashes = append(hashes, txHash)
+		if _, err = c.waitForTxSuccess(ctx, chainInfo, txHash); err != nil {
+			return hashes, err
+		}
+	}
+	return hashes, nil
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"so-omnichain-example/signer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testBundle 导出 approve 和 swap 两笔未签名交易
+func testBundle(t *testing.T, from common.Address) *TxBundle {
+	t.Helper()
+	bundle := &TxBundle{Chain: "goerli", ChainId: 5, From: from}
+	to := common.HexToAddress("0x7E88c5E7134E4589F6316636CA8Fe8Cc9f8ED505")
+	for i, kind := range []string{txKindApprove, txKindSwap} {
+		tx := types.NewTx(&types.DynamicFeeTx{
+			ChainID:   big.NewInt(5),
+			Nonce:     uint64(10 + i),
+			GasTipCap: big.NewInt(1e9),
+			GasFeeCap: big.NewInt(3e10),
+			Gas:       300000,
+			To:        &to,
+			Value:     big.NewInt(int64(i) * 1e16),
+			Data:      []byte{0x12, 0x34, 0x56, 0x78, byte(i)},
+		})
+		unsigned, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle.Txs = append(bundle.Txs, &BundleTx{Kind: kind, Unsigned: unsigned, Tx: tx})
+	}
+	return bundle
+}
+
+// writeSignedBundle 用 account 对 modify 修改后的交易签名，写入 bundle.json
+func writeSignedBundle(t *testing.T, bundle *TxBundle, account signer.Signer, modify func(i int, tx *types.DynamicFeeTx)) string {
+	t.Helper()
+	for i, bundleTx := range bundle.Txs {
+		inner := &types.DynamicFeeTx{
+			ChainID:   bundleTx.Tx.ChainId(),
+			Nonce:     bundleTx.Tx.Nonce(),
+			GasTipCap: bundleTx.Tx.GasTipCap(),
+			GasFeeCap: bundleTx.Tx.GasFeeCap(),
+			Gas:       bundleTx.Tx.Gas(),
+			To:        bundleTx.Tx.To(),
+			Value:     bundleTx.Tx.Value(),
+			Data:      bundleTx.Tx.Data(),
+		}
+		if modify != nil {
+			modify(i, inner)
+		}
+		signed, err := account.SignTx(types.NewTx(inner), inner.ChainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bundleTx.Signed, err = signed.MarshalBinary(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	if _, err := bundle.WriteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, bundleFileName)
+}
+
+func TestLoadSignedTxs(t *testing.T) {
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := testBundle(t, account.Address())
+	path := writeSignedBundle(t, bundle, account, nil)
+
+	txs, err := LoadSignedTxs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("loaded %d txs, want 2", len(txs))
+	}
+	for i, tx := range txs {
+		if tx.Nonce() != bundle.Txs[i].Tx.Nonce() || tx.Value().Cmp(bundle.Txs[i].Tx.Value()) != 0 {
+			t.Fatalf("tx %d = nonce %d value %s", i, tx.Nonce(), tx.Value())
+		}
+	}
+
+	// 单独的 hex 编码签名交易没有可比较的未签名交易，直接读取
+	raw := filepath.Join(t.TempDir(), "swap.rlp")
+	if err = os.WriteFile(raw, []byte(bundle.Txs[1].Signed.String()+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if txs, err = LoadSignedTxs(raw); err != nil || len(txs) != 1 || txs[0].Nonce() != bundle.Txs[1].Tx.Nonce() {
+		t.Fatalf("load raw signed tx: %v", err)
+	}
+}
+
+func TestLoadSignedTxsRejectsMismatch(t *testing.T) {
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := signer.NewPrivateKeySigner("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		account signer.Signer
+		modify  func(i int, tx *types.DynamicFeeTx)
+		want    string
+	}{
+		{
+			name:    "value",
+			account: account,
+			modify:  func(i int, tx *types.DynamicFeeTx) { tx.Value = big.NewInt(1e18) },
+			want:    "value differ",
+		},
+		{
+			name:    "recipient and data",
+			account: account,
+			modify: func(i int, tx *types.DynamicFeeTx) {
+				if i == 1 {
+					to := common.HexToAddress("0x0000000000000000000000000000000000000bad")
+					tx.To, tx.Data = &to, []byte{0xde, 0xad}
+				}
+			},
+			want: "swap tx: signed tx does not match the exported tx, to, data differ",
+		},
+		{
+			name:    "nonce and gas",
+			account: account,
+			modify:  func(i int, tx *types.DynamicFeeTx) { tx.Nonce, tx.Gas = tx.Nonce+1, tx.Gas*2 },
+			want:    "nonce, gas differ",
+		},
+		{
+			name:    "chain id",
+			account: account,
+			modify:  func(i int, tx *types.DynamicFeeTx) { tx.ChainID = big.NewInt(1) },
+			want:    "chainId differ",
+		},
+		{
+			name:    "other signer",
+			account: other,
+			want:    "expected " + account.Address().Hex(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeSignedBundle(t, testBundle(t, account.Address()), tt.account, tt.modify)
+			_, err := LoadSignedTxs(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSignedTxsUsesExportedTx(t *testing.T) {
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := testBundle(t, account.Address())
+	path := writeSignedBundle(t, bundle, account, nil)
+
+	// 只有 tx 字段时同样校验
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded TxBundle
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	for _, bundleTx := range loaded.Txs {
+		bundleTx.Unsigned = nil
+	}
+	loaded.Txs[0].Tx = types.NewTx(&types.DynamicFeeTx{ChainID: big.NewInt(5), Nonce: 99})
+	if data, err = json.Marshal(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadSignedTxs(path); err == nil || !strings.Contains(err.Error(), "approve tx") {
+		t.Fatalf("err = %v, want the approve tx rejected", err)
+	}
+
+	// 没有可比较的导出交易时拒绝
+	loaded.Txs[0].Tx = nil
+	if data, err = json.Marshal(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadSignedTxs(path); err == nil || !strings.Contains(err.Error(), "no exported tx") {
+		t.Fatalf("err = %v, want a missing exported tx error", err)
+	}
+}
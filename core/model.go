@@ -1,10 +1,11 @@
 package core
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"math/big"
-	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -21,16 +22,18 @@ type SoData struct {
 	Amount             *big.Int
 }
 
-func (d *SoData) print() {
-	fmt.Println("===========================================================")
-	fmt.Println("so data:")
-	fmt.Printf("transactionId:      %s\n", hex.EncodeToString(d.TransactionId[:]))
-	fmt.Printf("Receiver:           %s\n", d.Receiver.Hex())
-	fmt.Printf("SourceChainId:      %s\n", d.SourceChainId.String())
-	fmt.Printf("SendingAssetId:     %s\n", d.SendingAssetId.String())
-	fmt.Printf("DestinationChainId: %s\n", d.DestinationChainId.String())
-	fmt.Printf("ReceivingAssetId:   %s\n", d.ReceivingAssetId.String())
-	fmt.Printf("Amount:             %s\n", d.Amount.String())
+func (d *SoData) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "so data:")
+	fmt.Fprintf(&b, "transactionId:      %s\n", hex.EncodeToString(d.TransactionId[:]))
+	fmt.Fprintf(&b, "Receiver:           %s\n", d.Receiver.Hex())
+	fmt.Fprintf(&b, "SourceChainId:      %s\n", d.SourceChainId.String())
+	fmt.Fprintf(&b, "SendingAssetId:     %s\n", d.SendingAssetId.String())
+	fmt.Fprintf(&b, "DestinationChainId: %s\n", d.DestinationChainId.String())
+	fmt.Fprintf(&b, "ReceivingAssetId:   %s\n", d.ReceivingAssetId.String())
+	fmt.Fprintf(&b, "Amount:             %s\n", d.Amount.String())
+	return b.String()
 }
 
 // 1. 通用Uniswap/PancakeSwap数据结构
@@ -45,15 +48,17 @@ type SwapData struct {
 	CallData         []byte         //  The swap callData callData = abi.encodeWithSignature("swapExactETHForTokens", minAmount, [sendingAssetId, receivingAssetId], 以太坊SoDiamond地址, deadline)
 }
 
-func (d *SwapData) print() {
-	fmt.Println("===========================================================")
-	fmt.Println("swap data:")
-	fmt.Printf("CallTo:              %s\n", d.CallTo.String())
-	fmt.Printf("ApproveTo:           %s\n", d.ApproveTo.String())
-	fmt.Printf("SendingAssetId:      %s\n", d.SendingAssetId.String())
-	fmt.Printf("ReceivingAssetId:    %s\n", d.ReceivingAssetId.String())
-	fmt.Printf("FromAmount:          %s\n", d.FromAmount.String())
-	fmt.Printf("CallData:            %s\n", hex.EncodeToString(d.CallData))
+func (d *SwapData) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "swap data:")
+	fmt.Fprintf(&b, "CallTo:              %s\n", d.CallTo.String())
+	fmt.Fprintf(&b, "ApproveTo:           %s\n", d.ApproveTo.String())
+	fmt.Fprintf(&b, "SendingAssetId:      %s\n", d.SendingAssetId.String())
+	fmt.Fprintf(&b, "ReceivingAssetId:    %s\n", d.ReceivingAssetId.String())
+	fmt.Fprintf(&b, "FromAmount:          %s\n", d.FromAmount.String())
+	fmt.Fprintf(&b, "CallData:            %s\n", hex.EncodeToString(d.CallData))
+	return b.String()
 }
 
 // StargateData 传给 stargate 的数据
@@ -66,20 +71,22 @@ type StargateData struct {
 	DstSoDiamond       common.Address // 目的链 SoDiamond 地址
 }
 
-func (d *StargateData) print() {
-	fmt.Println("===========================================================")
-	fmt.Println("StargateData:")
-	fmt.Printf("SrcStargatePoolId:      %s\n", d.SrcStargatePoolId)
-	fmt.Printf("DstStargateChainId:     %d\n", d.DstStargateChainId)
-	fmt.Printf("DstStargatePoolId:      %s\n", d.DstStargatePoolId)
-	fmt.Printf("MinAmount:              %s\n", d.MinAmount)
-	fmt.Printf("DstGasForSgReceive:     %s\n", d.DstGasForSgReceive)
-	fmt.Printf("DstSoDiamond:           %s\n", d.DstSoDiamond)
+func (d *StargateData) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "StargateData:")
+	fmt.Fprintf(&b, "SrcStargatePoolId:      %s\n", d.SrcStargatePoolId)
+	fmt.Fprintf(&b, "DstStargateChainId:     %d\n", d.DstStargateChainId)
+	fmt.Fprintf(&b, "DstStargatePoolId:      %s\n", d.DstStargatePoolId)
+	fmt.Fprintf(&b, "MinAmount:              %s\n", d.MinAmount)
+	fmt.Fprintf(&b, "DstGasForSgReceive:     %s\n", d.DstGasForSgReceive)
+	fmt.Fprintf(&b, "DstSoDiamond:           %s\n", d.DstSoDiamond)
+	return b.String()
 }
 
-func newStargateData(fromChain Chain, toChain Chain, minAmount, dstGas *big.Int) StargateData {
-	srcPoolId := big.NewInt(int64(fromChain.StargetaPoolId))
-	dstPoolId := big.NewInt(int64(toChain.StargetaPoolId))
+func newStargateData(srcBridgeToken Token, toChain Chain, dstBridgeToken Token, minAmount, dstGas *big.Int) StargateData {
+	srcPoolId := big.NewInt(int64(srcBridgeToken.StargatePoolId))
+	dstPoolId := big.NewInt(int64(dstBridgeToken.StargatePoolId))
 	data := StargateData{}
 	data.SrcStargatePoolId = srcPoolId
 	data.DstStargateChainId = uint16(toChain.StargateChainId)
@@ -103,16 +110,17 @@ func newSoData(receiver string, sourceChainId int, sendingAssetId string, destin
 }
 
 // newSwapData 构造 SwapData
-func newSwapData(chain Chain, fromTokenAddress string, toTokenAddress string, fromAmount, minAmount *big.Int) (SwapData, []common.Address, error) {
+func (c *Client) newSwapData(chain Chain, fromTokenAddress string, toTokenAddress string, fromAmount, minAmount *big.Int, deadline time.Time) (SwapData, []common.Address, error) {
+	// IUniswapV2Router02AVAX 的原生币方法名为 swapExactAVAXForTokens 等，按配置的 swap 类型选择，不依赖链名
 	ethName := "ETH"
-	if chain.Name == "avax-test" {
+	if chain.Swap[0][1] == swapTypeUniswapV2Avax {
 		ethName = "AVAX"
 	}
 
 	// swap 合约
 	swapVersion := versionV2
 	quoteAdderss := ""
-	if chain.Swap[0][1] == "ISwapRouter" {
+	if chain.Swap[0][1] == swapTypeUniswapV3 {
 		swapVersion = versionV3
 		quoteAdderss = chain.Swap[0][2]
 	}
@@ -132,8 +140,8 @@ func newSwapData(chain Chain, fromTokenAddress string, toTokenAddress string, fr
 		path = append(path, common.HexToAddress(toTokenAddress))
 	}
 
-	callMsg, err := newUnisapV2Contract(swapContractAddress, swapVersion, quoteAdderss).
-		PackInput(funcName, fromAmount, minAmount, path, common.HexToAddress(chain.SoDiamond))
+	callMsg, err := newUnisapV2Contract(c.abis, swapContractAddress, swapVersion, quoteAdderss).
+		PackInput(funcName, fromAmount, minAmount, path, common.HexToAddress(chain.SoDiamond), big.NewInt(deadline.Unix()))
 	if err != nil {
 		return SwapData{}, path, err
 	}
@@ -169,9 +177,9 @@ func isZeroAddress(address string) bool {
 	return address == zeroAddress || address == zeroAddressNoPrefix
 }
 
+// randomTransactionId 使用 crypto/rand 生成交易 ID，同一秒内发起的多笔 swap 也不会重复
 func randomTransactionId() [32]byte {
 	var res [32]byte
-	rand.Seed(time.Now().Unix())
 	_, err := rand.Read(res[:])
 	if err != nil {
 		panic(err)
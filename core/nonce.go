@@ -0,0 +1,261 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"so-omnichain-example/signer"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// nonceKey 一条链上的一个账户
+type nonceKey struct {
+	chainId int
+	address common.Address
+}
+
+// accountNonce 单个账户在本地分配的 nonce
+type accountNonce struct {
+	l        sync.Mutex
+	synced   bool     // next 是否可信，为 false 时下次分配以链上 pending nonce 为准
+	next     uint64   // 下一个未分配过的 nonce
+	released []uint64 // 发送失败归还的 nonce，从小到大，优先分配
+}
+
+// nonceManager 按 (链, 账户) 在本地分配 nonce
+// 连续发送 approve 和 swap，或者同一账户并发 swap 时，节点的 pending nonce 可能还没有包含刚发送的交易，
+// 本地记录已分配的 nonce 可以避免重复
+type nonceManager struct {
+	l        sync.Mutex
+	accounts map[nonceKey]*accountNonce
+}
+
+// nonceSource 查询账户在链上的 pending nonce
+type nonceSource func(ctx context.Context, account common.Address) (uint64, error)
+
+func newNonceManager() *nonceManager {
+	return &nonceManager{accounts: make(map[nonceKey]*accountNonce)}
+}
+
+func (m *nonceManager) account(key nonceKey) *accountNonce {
+	m.l.Lock()
+	defer m.l.Unlock()
+	a, ok := m.accounts[key]
+	if !ok {
+		a = &accountNonce{}
+		m.accounts[key] = a
+	}
+	return a
+}
+
+// reserve 分配一个 nonce：取链上 pending nonce 与本地记录的较大值，优先使用归还的空缺
+// 其他程序使用同一账户发送交易时，pending nonce 会超过本地记录，以链上为准
+func (m *nonceManager) reserve(ctx context.Context, pendingNonceAt nonceSource, key nonceKey) (uint64, error) {
+	a := m.account(key)
+	a.l.Lock()
+	defer a.l.Unlock()
+	pending, err := pendingNonceAt(ctx, key.address)
+	if err != nil {
+		if !a.synced {
+			return 0, err
+		}
+		// 查询失败时使用本地记录
+		pending = 0
+	}
+	a.advance(pending)
+	a.synced = true
+	if len(a.released) > 0 {
+		nonce := a.released[0]
+		a.released = a.released[1:]
+		return nonce, nil
+	}
+	nonce := a.next
+	a.next++
+	return nonce, nil
+}
+
+// release 交易没有发送成功时归还 nonce，下次优先分配，避免留下空缺导致后续交易一直 pending
+func (m *nonceManager) release(key nonceKey, nonce uint64) {
+	a := m.account(key)
+	a.l.Lock()
+	defer a.l.Unlock()
+	if nonce+1 == a.next {
+		a.next--
+		// 末尾连续的空缺一起收回
+		for len(a.released) > 0 && a.released[len(a.released)-1]+1 == a.next {
+			a.released = a.released[:len(a.released)-1]
+			a.next--
+		}
+		return
+	}
+	if nonce < a.next {
+		a.released = append(a.released, nonce)
+		sort.Slice(a.released, func(i, j int) bool { return a.released[i] < a.released[j] })
+	}
+}
+
+// invalidate 发送结果未知（如连接中断）时调用，nonce 可能已被使用，下次分配以链上 pending nonce 为准
+func (m *nonceManager) invalidate(key nonceKey) {
+	a := m.account(key)
+	a.l.Lock()
+	defer a.l.Unlock()
+	a.synced = false
+	a.released = nil
+}
+
+// resync 节点返回 nonce too low 时调用，按链上 pending nonce 修正本地记录
+func (m *nonceManager) resync(ctx context.Context, pendingNonceAt nonceSource, key nonceKey) error {
+	pending, err := pendingNonceAt(ctx, key.address)
+	if err != nil {
+		return err
+	}
+	a := m.account(key)
+	a.l.Lock()
+	defer a.l.Unlock()
+	a.advance(pending)
+	a.synced = true
+	return nil
+}
+
+// advance 链上 pending nonce 之前的 nonce 都已被使用
+func (a *accountNonce) advance(pending uint64) {
+	if !a.synced || a.next < pending {
+		a.next = pending
+	}
+	i := 0
+	for i < len(a.released) && a.released[i] < pending {
+		i++
+	}
+	a.released = a.released[i:]
+}
+
+// isNonceTooLow 节点因 nonce 已被已上链的交易使用而拒绝交易
+func isNonceTooLow(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// isReplacementUnderpriced 交易池中有相同 nonce 的交易，新交易的 gas 费不够替换它
+func isReplacementUnderpriced(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "replacement transaction underpriced")
+}
+
+// sendTx 从 nonceManager 分配 nonce，构造并签名交易后发送，返回交易 hash
+func (c *Client) sendTx(ctx context.Context, chain Chain, account signer.Signer, msg ethereum.CallMsg, value *big.Int) (string, error) {
+	key := nonceKey{chainId: chain.ChainId, address: account.Address()}
+	pool := c.getConnectPool(chain)
+	pendingNonceAt := func(ctx context.Context, address common.Address) (nonce uint64, err error) {
+		err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			nonce, err = c1.PendingNonceAt(ctx, address)
+			return err
+		})
+		return nonce, err
+	}
+	sign := func(nonce uint64) (*types.Transaction, error) {
+		var rawTx *types.Transaction
+		err := pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) (err error) {
+			rawTx, err = createRawTxWithOptions(ctx, c1, key.address, msg.To, msg, value, txOptions{nonce: &nonce})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return account.SignTx(rawTx, rawTx.ChainId())
+	}
+	send := func(tx *types.Transaction) error {
+		return c.sendSignedTx(ctx, chain, tx)
+	}
+	tx, err := c.nonces.send(ctx, pendingNonceAt, key, sign, send, c.logger)
+	if err != nil {
+		return "", err
+	}
+	return tx.Hash().Hex(), nil
+}
+
+// send 分配 nonce 后调用 sign 构造并签名交易，再调用 send 发送，返回发送成功的交易
+// 交易只签名一次，send 切换 rpc 地址及重试时发送的都是同一笔交易，不会重复上链
+// nonce too low 时按链上 nonce 重新分配并重试一次；节点拒绝交易或者构造、签名失败时归还 nonce；
+// 交易池中有相同 nonce 的 pending 交易时直接返回错误，需要先加速或取消该交易；发送结果未知时下次以链上为准
+func (m *nonceManager) send(ctx context.Context, pendingNonceAt nonceSource, key nonceKey,
+	sign func(nonce uint64) (*types.Transaction, error), send func(*types.Transaction) error, logger Logger) (*types.Transaction, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := m.reserve(ctx, pendingNonceAt, key)
+		if err != nil {
+			return nil, err
+		}
+		signedTx, err := sign(nonce)
+		if err != nil {
+			m.release(key, nonce)
+			return nil, err
+		}
+		err = send(signedTx)
+		if err == nil {
+			return signedTx, nil
+		}
+		var rpcErr rpc.Error
+		switch {
+		case isReplacementUnderpriced(err):
+			// nonce 被交易池中的其他交易占用，归还后下次还会失败
+			return nil, fmt.Errorf("nonce %d is used by a pending transaction, speed it up or cancel it: %w", nonce, err)
+		case isNonceTooLow(err) && attempt == 0:
+			if resyncErr := m.resync(ctx, pendingNonceAt, key); resyncErr != nil {
+				return nil, err
+			}
+			logger.Printf("nonce %d already used on chain %d, retry with a new nonce\n", nonce, key.chainId)
+			continue
+		case errors.As(err, &rpcErr):
+			// 节点明确拒绝了交易，nonce 没有被使用
+			m.release(key, nonce)
+		default:
+			m.invalidate(key)
+			return nil, fmt.Errorf("send tx %s: %w", signedTx.Hash().Hex(), err)
+		}
+		return nil, err
+	}
+}
+
+// txBackend 发送交易用到的节点接口，由 ethclient.Client 实现
+type txBackend interface {
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
+// sendSignedTx 发送已签名的交易，连接错误等需要切换 rpc 地址时重新发送的是同一笔交易，所有地址都失败时按重试策略再次发送
+func (c *Client) sendSignedTx(ctx context.Context, chain Chain, tx *types.Transaction) error {
+	sent := false
+	return c.getConnectPool(chain).Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		resend := sent
+		sent = true
+		return sendRawTx(ctx, c1, tx, resend)
+	})
+}
+
+// sendRawTx 发送一次已签名的交易，节点返回 already known 说明交易已在交易池中，视为成功
+// resend 为 true 时之前可能已经发送成功，节点返回 nonce too low 或 underpriced 而这笔交易能查到，同样视为成功
+func sendRawTx(ctx context.Context, backend txBackend, tx *types.Transaction, resend bool) error {
+	err := backend.SendTransaction(ctx, tx)
+	if err == nil || isAlreadyKnown(err) {
+		return nil
+	}
+	if resend && (isNonceTooLow(err) || isReplacementUnderpriced(err)) {
+		if _, _, findErr := backend.TransactionByHash(ctx, tx.Hash()); findErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// isAlreadyKnown 节点的交易池中已有这笔交易
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
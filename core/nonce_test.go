@@ -0,0 +1,387 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var testNonceKey = nonceKey{chainId: 5, address: common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")}
+
+// fakeNonceSource 模拟链上的 pending nonce
+type fakeNonceSource struct {
+	mu      sync.Mutex
+	pending uint64
+	err     error
+	calls   int
+}
+
+func (s *fakeNonceSource) pendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return s.pending, s.err
+}
+
+func (s *fakeNonceSource) set(pending uint64) {
+	s.mu.Lock()
+	s.pending = pending
+	s.mu.Unlock()
+}
+
+// testRpcError 节点返回的 json-rpc 错误
+type testRpcError struct {
+	msg string
+}
+
+func (e testRpcError) Error() string  { return e.msg }
+func (e testRpcError) ErrorCode() int { return -32000 }
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, args ...interface{}) {
+	l.t.Logf(format, args...)
+}
+
+func mustReserve(t *testing.T, m *nonceManager, src *fakeNonceSource) uint64 {
+	t.Helper()
+	nonce, err := m.reserve(context.Background(), src.pendingNonceAt, testNonceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+func TestNonceReserveConcurrent(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{pending: 7}
+
+	const n = 100
+	nonces := make(chan uint64, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := m.reserve(context.Background(), src.pendingNonceAt, testNonceKey)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			nonces <- nonce
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+
+	seen := make(map[uint64]bool)
+	for nonce := range nonces {
+		if seen[nonce] {
+			t.Fatalf("nonce %d reserved twice", nonce)
+		}
+		if nonce < 7 || nonce >= 7+n {
+			t.Fatalf("nonce %d outside [7, %d)", nonce, 7+n)
+		}
+		seen[nonce] = true
+	}
+	if len(seen) != n {
+		t.Fatalf("reserved %d nonces, want %d", len(seen), n)
+	}
+}
+
+func TestNonceReleaseFillsGap(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{}
+	for want := uint64(0); want < 4; want++ {
+		if got := mustReserve(t, m, src); got != want {
+			t.Fatalf("nonce %d, want %d", got, want)
+		}
+	}
+
+	// 中间的空缺优先分配
+	m.release(testNonceKey, 1)
+	if got := mustReserve(t, m, src); got != 1 {
+		t.Fatalf("nonce %d, want released 1", got)
+	}
+	// 末尾连续的空缺一起收回
+	m.release(testNonceKey, 2)
+	m.release(testNonceKey, 3)
+	if got := mustReserve(t, m, src); got != 2 {
+		t.Fatalf("nonce %d, want 2", got)
+	}
+	if got := mustReserve(t, m, src); got != 3 {
+		t.Fatalf("nonce %d, want 3", got)
+	}
+}
+
+func TestNonceFollowsChain(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{}
+	mustReserve(t, m, src)
+	mustReserve(t, m, src)
+	m.release(testNonceKey, 0)
+
+	// 其他程序使用同一账户发送了交易，以链上为准，已被使用的空缺丢弃
+	src.set(10)
+	if got := mustReserve(t, m, src); got != 10 {
+		t.Fatalf("nonce %d, want chain pending 10", got)
+	}
+
+	// 查询失败时使用本地记录
+	src.err = errors.New("connection refused")
+	if got := mustReserve(t, m, src); got != 11 {
+		t.Fatalf("nonce %d, want local 11", got)
+	}
+	src.err = nil
+
+	// invalidate 之后以链上为准，即使链上 nonce 比本地记录小
+	m.invalidate(testNonceKey)
+	src.set(11)
+	if got := mustReserve(t, m, src); got != 11 {
+		t.Fatalf("nonce %d after invalidate, want chain pending 11", got)
+	}
+}
+
+func TestNonceReserveFailsBeforeSync(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{err: errors.New("connection refused")}
+	if _, err := m.reserve(context.Background(), src.pendingNonceAt, testNonceKey); err == nil {
+		t.Fatal("reserve without any chain nonce succeeded")
+	}
+}
+
+// fakeTxSender 记录 send 收到的交易，按顺序返回 errs 中的错误
+type fakeTxSender struct {
+	mu   sync.Mutex
+	sent []*types.Transaction
+	errs []error
+}
+
+func (s *fakeTxSender) sign(nonce uint64) (*types.Transaction, error) {
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: big.NewInt(1), Gas: 21000, To: &to}), nil
+}
+
+func (s *fakeTxSender) send(tx *types.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, tx)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestNonceSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   string
+		wantSent  []uint64 // send 收到的交易的 nonce
+		resync    uint64   // 第一次发送后链上的 pending nonce
+		nextNonce uint64   // 之后再分配的 nonce
+	}{
+		{
+			name:      "success",
+			wantSent:  []uint64{3},
+			resync:    3,
+			nextNonce: 4,
+		},
+		{
+			name:      "rejected by node releases nonce",
+			errs:      []error{testRpcError{"insufficient funds for gas * price + value"}},
+			wantErr:   "insufficient funds",
+			wantSent:  []uint64{3},
+			resync:    3,
+			nextNonce: 3,
+		},
+		{
+			name:      "nonce too low resyncs and retries once",
+			errs:      []error{testRpcError{"nonce too low"}},
+			wantSent:  []uint64{3, 5},
+			resync:    5,
+			nextNonce: 6,
+		},
+		{
+			name:      "nonce too low twice gives up",
+			errs:      []error{testRpcError{"nonce too low"}, testRpcError{"nonce too low"}},
+			wantErr:   "nonce too low",
+			wantSent:  []uint64{3, 5},
+			resync:    5,
+			nextNonce: 5,
+		},
+		{
+			name:      "replacement underpriced keeps nonce",
+			errs:      []error{testRpcError{"replacement transaction underpriced"}},
+			wantErr:   "speed it up or cancel it",
+			wantSent:  []uint64{3},
+			resync:    3,
+			nextNonce: 4,
+		},
+		{
+			name:      "unknown result trusts chain",
+			errs:      []error{io.ErrUnexpectedEOF},
+			wantErr:   "unexpected EOF",
+			wantSent:  []uint64{3},
+			resync:    4, // 交易实际已经进入交易池
+			nextNonce: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newNonceManager()
+			src := &fakeNonceSource{pending: 3}
+			sender := &fakeTxSender{errs: tt.errs}
+			send := func(tx *types.Transaction) error {
+				err := sender.send(tx)
+				src.set(tt.resync)
+				return err
+			}
+			tx, err := m.send(context.Background(), src.pendingNonceAt, testNonceKey, sender.sign, send, testLogger{t})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if last := sender.sent[len(sender.sent)-1]; tx != last {
+					t.Fatal("returned tx is not the one sent")
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+
+			var sent []uint64
+			for _, tx := range sender.sent {
+				sent = append(sent, tx.Nonce())
+			}
+			if len(sent) != len(tt.wantSent) {
+				t.Fatalf("sent nonces %v, want %v", sent, tt.wantSent)
+			}
+			for i := range sent {
+				if sent[i] != tt.wantSent[i] {
+					t.Fatalf("sent nonces %v, want %v", sent, tt.wantSent)
+				}
+			}
+			if got := mustReserve(t, m, src); got != tt.nextNonce {
+				t.Fatalf("next nonce %d, want %d", got, tt.nextNonce)
+			}
+		})
+	}
+}
+
+func TestNonceSendSignFailureReleases(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{pending: 3}
+	sign := func(uint64) (*types.Transaction, error) { return nil, errors.New("signer rejected") }
+	send := func(*types.Transaction) error {
+		t.Fatal("unsigned tx sent")
+		return nil
+	}
+	if _, err := m.send(context.Background(), src.pendingNonceAt, testNonceKey, sign, send, testLogger{t}); err == nil {
+		t.Fatal("sign error not returned")
+	}
+	if got := mustReserve(t, m, src); got != 3 {
+		t.Fatalf("next nonce %d, want released 3", got)
+	}
+}
+
+func TestNonceSendConcurrent(t *testing.T) {
+	m := newNonceManager()
+	src := &fakeNonceSource{}
+	sender := &fakeTxSender{}
+	// 一部分交易被节点拒绝，归还的 nonce 被后续交易重新使用
+	var mu sync.Mutex
+	count := 0
+	send := func(tx *types.Transaction) error {
+		mu.Lock()
+		count++
+		reject := count%5 == 0
+		mu.Unlock()
+		if reject {
+			return testRpcError{"gas limit reached"}
+		}
+		return sender.send(tx)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = m.send(context.Background(), src.pendingNonceAt, testNonceKey, sender.sign, send, testLogger{t})
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	for _, tx := range sender.sent {
+		if seen[tx.Nonce()] {
+			t.Fatalf("nonce %d sent twice", tx.Nonce())
+		}
+		seen[tx.Nonce()] = true
+	}
+	// 被拒绝的 nonce 都已被重新使用，没有留下空缺
+	for nonce := uint64(0); nonce < uint64(len(seen)); nonce++ {
+		if !seen[nonce] {
+			t.Fatalf("gap at nonce %d, sent %d txs", nonce, len(seen))
+		}
+	}
+}
+
+// fakeTxBackend 模拟节点发送交易及查询交易
+type fakeTxBackend struct {
+	sendErr error
+	known   bool // TransactionByHash 能否查到交易
+	sends   int
+}
+
+func (b *fakeTxBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	b.sends++
+	return b.sendErr
+}
+
+func (b *fakeTxBackend) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	if !b.known {
+		return nil, false, errors.New("not found")
+	}
+	return nil, true, nil
+}
+
+func TestSendRawTx(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend fakeTxBackend
+		resend  bool
+		wantErr bool
+	}{
+		{"sent", fakeTxBackend{}, false, false},
+		{"already known", fakeTxBackend{sendErr: testRpcError{"already known"}}, false, false},
+		{"known transaction", fakeTxBackend{sendErr: testRpcError{"known transaction: 0x12"}}, true, false},
+		{"nonce too low on first send", fakeTxBackend{sendErr: testRpcError{"nonce too low"}, known: true}, false, true},
+		{"nonce too low on resend of a mined tx", fakeTxBackend{sendErr: testRpcError{"nonce too low"}, known: true}, true, false},
+		{"nonce too low on resend of an unknown tx", fakeTxBackend{sendErr: testRpcError{"nonce too low"}}, true, true},
+		{"underpriced on resend of our tx", fakeTxBackend{sendErr: testRpcError{"replacement transaction underpriced"}, known: true}, true, false},
+		{"underpriced on first send", fakeTxBackend{sendErr: testRpcError{"replacement transaction underpriced"}, known: true}, false, true},
+		{"other error", fakeTxBackend{sendErr: testRpcError{"insufficient funds"}, known: true}, true, true},
+	}
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1), Gas: 21000, To: &to})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendRawTx(context.Background(), &tt.backend, tx, tt.resend)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// quoteReceiver 报价时未指定接收地址，使用此地址预估目标链 gas
+const quoteReceiver = "0x000000000000000000000000000000000000dEaD"
+
+// Quote 报价结果，只读取链上数据，不签名也不发送交易
+type Quote struct {
+	FromChain string
+	ToChain   string
+	FromToken Token
+	ToToken   Token
+
+	AmountIn          *big.Int // from token 数量
+	ExpectedOut       *big.Int // 无滑点时预计得到的 to token 数量
+	MinOut            *big.Int // 根据滑点计算的最少得到的 to token 数量
+	StargateMinAmount *big.Int // stargate 跨链最少得到的数量，单链 swap 为 0
+	StargateFee       *big.Int // stargate 跨链手续费，原生币，单链 swap 为 0
+	SoFee             *big.Int // so fee，单链 swap 为 0
+	DstGas            *big.Int // 目的链 sgReceive 预估 gas，单链 swap 为 0
+	Value             *big.Int // 交易需要发送的原生币总数
+
+	Slippage float64
+	Deadline time.Time
+}
+
+func (q *Quote) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "quote:")
+	fmt.Fprintf(&b, "From:               %s %s\n", q.FromChain, q.FromToken.Symbol)
+	fmt.Fprintf(&b, "To:                 %s %s\n", q.ToChain, q.ToToken.Symbol)
+	fmt.Fprintf(&b, "AmountIn:           %s (%s)\n", q.AmountIn, formatAmount(q.AmountIn, q.FromToken.Decimals))
+	fmt.Fprintf(&b, "ExpectedOut:        %s (%s)\n", q.ExpectedOut, formatAmount(q.ExpectedOut, q.ToToken.Decimals))
+	fmt.Fprintf(&b, "MinOut:             %s (%s)\n", q.MinOut, formatAmount(q.MinOut, q.ToToken.Decimals))
+	fmt.Fprintf(&b, "StargateMinAmount:  %s\n", q.StargateMinAmount)
+	fmt.Fprintf(&b, "StargateFee:        %s (%s)\n", q.StargateFee, formatAmount(q.StargateFee, nativeDecimals))
+	fmt.Fprintf(&b, "SoFee:              %s\n", q.SoFee)
+	fmt.Fprintf(&b, "DstGas:             %s\n", q.DstGas)
+	fmt.Fprintf(&b, "Value:              %s (%s)\n", q.Value, formatAmount(q.Value, nativeDecimals))
+	fmt.Fprintf(&b, "Slippage:           %.2f%%\n", q.Slippage*100)
+	fmt.Fprintf(&b, "Deadline:           %s (%d)\n", q.Deadline.Format(time.RFC3339), q.Deadline.Unix())
+	return b.String()
+}
+
+// swapRoute 一次 swap 需要发送的全部合约参数，以及对应的报价
+type swapRoute struct {
+	fromChain    Chain
+	toChain      Chain
+	soData       SoData
+	srcSwapData  []SwapData
+	stargateData StargateData // 单链 swap 为空
+	dstSwapData  []SwapData
+	quote        Quote
+}
+
+// GetQuote 对 swap 请求报价，执行所有预估但不签名、不发送交易
+func (c *Client) GetQuote(ctx context.Context, req SwapRequest) (*Quote, error) {
+	if req.Receiver == "" {
+		req.Receiver = quoteReceiver
+	}
+	req, sameChain, err := c.resolveRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	var route *swapRoute
+	if sameChain {
+		route, err = c.planSameChain(ctx, req)
+	} else {
+		route, err = c.planDiffChain(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if route == nil {
+		return nil, fmt.Errorf("nothing to swap: %s to %s", req.FromToken, req.ToToken)
+	}
+	return &route.quote, nil
+}
+
+// planDiffChain 构造跨链 swap 的合约参数并完成所有预估
+func (c *Client) planDiffChain(ctx context.Context, req SwapRequest) (*swapRoute, error) {
+	txSendValue := big.NewInt(0)
+	fromChainInfo, fromTokenInfo, err := c.getChainAndToken(ctx, req.FromChain, req.FromToken)
+	if err != nil {
+		return nil, err
+	}
+	toChainInfo, toTokenInfo, err := c.getChainAndToken(ctx, req.ToChain, req.ToToken)
+	if err != nil {
+		return nil, err
+	}
+	fromAmount, err := req.Amount.toBigInt(fromTokenInfo)
+	if err != nil {
+		return nil, err
+	}
+	// stargate 跨链仅支持 usdc usdt 等有 stargate pool 的 token，其他 token 需要先 swap
+	srcBridgeToken, err := c.resolveToken(ctx, fromChainInfo, fromChainInfo.bridgeToken(fromTokenInfo))
+	if err != nil {
+		return nil, err
+	}
+	dstBridgeToken, err := c.resolveToken(ctx, toChainInfo, toChainInfo.bridgeToken(toTokenInfo))
+	if err != nil {
+		return nil, err
+	}
+	fromTokenAddress := fromTokenInfo.Address
+	toTokenAddress := toTokenInfo.Address
+	slippage := req.slippage(defaultCrossChainSlippage)
+	deadline := req.deadline()
+	soData := newSoData(req.Receiver, fromChainInfo.ChainId, fromTokenAddress, toChainInfo.ChainId, toTokenAddress, fromAmount)
+	srcSwapData := make([]SwapData, 0)
+	var srcUniswapPath []common.Address
+	dstSwapData := make([]SwapData, 0)
+	var dstUniswapPath []common.Address
+	if !sameAddress(fromTokenAddress, srcBridgeToken.Address) {
+		srcSwapData, srcUniswapPath, err = c.createSwapData(fromChainInfo, fromTokenAddress, srcBridgeToken.Address, fromAmount, big.NewInt(0), deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fromTokenInfo.Native {
+		txSendValue = big.NewInt(0).Add(txSendValue, fromAmount)
+	}
+	if !sameAddress(toTokenAddress, dstBridgeToken.Address) {
+		// 发交易前需要重新生成
+		// dstSwap 的 fromAmount 填 0 即可，合约会自动填入
+		dstSwapData, dstUniswapPath, err = c.createSwapData(toChainInfo, dstBridgeToken.Address, toTokenAddress, big.NewInt(0), big.NewInt(0), deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 1. 估算目标链交易需要的 dst gas fee，此手续费用来计算 stargate 跨链的总体手续费
+	dstGasUint64, err := c.estimateForGas(ctx, toChainInfo, dstBridgeToken, soData, dstSwapData)
+	if err != nil {
+		return nil, err
+	}
+	dstGas := big.NewInt(int64(dstGasUint64))
+	c.logger.Printf("sgReceive 预估手续费：%s\n", dstGas)
+	stargateData := newStargateData(srcBridgeToken, toChainInfo, dstBridgeToken, big.NewInt(0), dstGas)
+
+	// 从源链获取 stargate cross fee，并计算发给 sodiamond 的 value
+	// 2. 预估最终得到的 final amount
+	finalAmount, soFee, err := c.estimateFinalAmount(ctx, fromChainInfo, srcBridgeToken, fromAmount, srcUniswapPath, stargateData, toChainInfo, dstBridgeToken, dstUniswapPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 根据滑点预估 stargate 发送到目标链的 min amount，并重新构造 dstSwapData
+	minAmount, stargateMinAmount, err := c.estimateMinAmount(ctx, srcBridgeToken, toChainInfo, dstBridgeToken, finalAmount, float32(slippage), dstUniswapPath)
+	if err != nil {
+		return nil, err
+	}
+	stargateData.MinAmount = stargateMinAmount
+	c.logger.Printf("amountOut: %s  amountMinOut: %s\n", finalAmount, minAmount)
+	c.logger.Printf("stargate min amount: %s\n", stargateData.MinAmount)
+	if len(dstUniswapPath) > 0 {
+		dstSwapData, _, err = c.createSwapData(toChainInfo, dstBridgeToken.Address, toTokenAddress, big.NewInt(0), minAmount, deadline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 4. 计算 stargateFee，跟 value 相加作为最后发送的 value
+	stargateFee, err := c.getStargateFee(ctx, fromChainInfo, soData, stargateData, dstSwapData)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Printf("get stargate fee: %s eth\n", formatAmount(stargateFee, nativeDecimals))
+	txSendValue = big.NewInt(0).Add(txSendValue, stargateFee)
+
+	return &swapRoute{
+		fromChain:    fromChainInfo,
+		toChain:      toChainInfo,
+		soData:       soData,
+		srcSwapData:  srcSwapData,
+		stargateData: stargateData,
+		dstSwapData:  dstSwapData,
+		quote: Quote{
+			FromChain:         fromChainInfo.Name,
+			ToChain:           toChainInfo.Name,
+			FromToken:         fromTokenInfo,
+			ToToken:           toTokenInfo,
+			AmountIn:          fromAmount,
+			ExpectedOut:       finalAmount,
+			MinOut:            minAmount,
+			StargateMinAmount: stargateMinAmount,
+			StargateFee:       stargateFee,
+			SoFee:             soFee,
+			DstGas:            dstGas,
+			Value:             txSendValue,
+			Slippage:          slippage,
+			Deadline:          deadline,
+		},
+	}, nil
+}
+
+// planSameChain 构造单链 swap 的合约参数并完成预估，from token 与 to token 相同时返回 nil
+func (c *Client) planSameChain(ctx context.Context, req SwapRequest) (*swapRoute, error) {
+	// 获取当前执行环境
+	chainInfo, fromTokenInfo, err := c.getChainAndToken(ctx, req.FromChain, req.FromToken)
+	if err != nil {
+		return nil, err
+	}
+	_, toTokenInfo, err := c.getChainAndToken(ctx, req.FromChain, req.ToToken)
+	if err != nil {
+		return nil, err
+	}
+	if sameAddress(fromTokenInfo.Address, toTokenInfo.Address) {
+		return nil, nil
+	}
+	fromAmount, err := req.Amount.toBigInt(fromTokenInfo)
+	if err != nil {
+		return nil, err
+	}
+	fromTokenAddress := fromTokenInfo.Address
+	toTokenAddress := toTokenInfo.Address
+	slippage := req.slippage(defaultSameChainSlippage)
+	deadline := req.deadline()
+
+	// 构造基本的数据结构
+	soData := newSoData(req.Receiver, chainInfo.ChainId, fromTokenAddress, chainInfo.ChainId, toTokenAddress, fromAmount)
+	// 构造 uniswapPath，生产环境下应按照 pair 库存寻找最佳路径
+	_, uniswapPath, err := c.createSwapData(chainInfo, fromTokenAddress, toTokenAddress, fromAmount, big.NewInt(0), deadline)
+	if err != nil {
+		return nil, err
+	}
+	txSendValue := big.NewInt(0)
+	if fromTokenInfo.Native {
+		txSendValue = big.NewInt(0).Add(txSendValue, fromAmount)
+	}
+
+	// 1. 根据滑点计算 minAmount，构造 swapData
+	amountOut, amountMinOut, err := c.estimateUniswapAmount(ctx, chainInfo, fromAmount, float32(slippage), uniswapPath)
+	if err != nil {
+		return nil, err
+	}
+	swapData, _, err := c.createSwapData(chainInfo, fromTokenAddress, toTokenAddress, fromAmount, amountMinOut, deadline)
+	if err != nil {
+		return nil, err
+	}
+	c.logger.Printf("amountOut: %s  amountMinOut: %s\n", amountOut, amountMinOut)
+
+	return &swapRoute{
+		fromChain:   chainInfo,
+		toChain:     chainInfo,
+		soData:      soData,
+		srcSwapData: swapData,
+		quote: Quote{
+			FromChain:         chainInfo.Name,
+			ToChain:           chainInfo.Name,
+			FromToken:         fromTokenInfo,
+			ToToken:           toTokenInfo,
+			AmountIn:          fromAmount,
+			ExpectedOut:       amountOut,
+			MinOut:            amountMinOut,
+			StargateMinAmount: big.NewInt(0),
+			StargateFee:       big.NewInt(0),
+			SoFee:             big.NewInt(0),
+			DstGas:            big.NewInt(0),
+			Value:             txSendValue,
+			Slippage:          slippage,
+			Deadline:          deadline,
+		},
+	}, nil
+}
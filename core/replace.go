@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// defaultFeeBump 加速、取消交易时 gas 费默认提高的百分比
+	defaultFeeBump = 12
+	// minFeeBump 节点替换相同 nonce 的交易要求 GasTipCap、GasFeeCap 至少提高 10%
+	minFeeBump = 10
+	// cancelGasLimit 取消交易使用的 0 转账的 gas limit
+	cancelGasLimit = 21000
+)
+
+var errTxNotPending = errors.New("transaction is not pending")
+
+// SpeedUpTx 使用相同 nonce 重新发送 chain 上 pending 的交易，GasTipCap、GasFeeCap 提高 bump%，返回新交易的 hash
+// bump 为 0 时提高 12%，不能小于 10；新的 gas 费不低于当前建议的 gas 费
+func (c *Client) SpeedUpTx(ctx context.Context, chain string, txHash string, bump int) (string, error) {
+	return c.replacePending(ctx, chain, txHash, false, bump)
+}
+
+// CancelTx 使用相同 nonce 及提高 bump% 的 gas 费向自己发送 0 转账，替换 chain 上 pending 的交易，返回新交易的 hash
+func (c *Client) CancelTx(ctx context.Context, chain string, txHash string, bump int) (string, error) {
+	return c.replacePending(ctx, chain, txHash, true, bump)
+}
+
+func (c *Client) replacePending(ctx context.Context, chain string, txHash string, cancel bool, bump int) (string, error) {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return "", err
+	}
+	account, err := c.signer()
+	if err != nil {
+		return "", err
+	}
+	hash := common.HexToHash(txHash)
+	pool := c.getConnectPool(chainInfo)
+	var (
+		tx        *types.Transaction
+		isPending bool
+	)
+	err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		tx, isPending, err = c1.TransactionByHash(ctx, hash)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("get tx %s: %w", txHash, err)
+	}
+	if !isPending {
+		return "", fmt.Errorf("%w: %s", errTxNotPending, txHash)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return "", err
+	}
+	if from != account.Address() {
+		return "", fmt.Errorf("tx %s is sent by %s, not the signer %s", txHash, from.Hex(), account.Address().Hex())
+	}
+	newTx, err := c.replaceTx(ctx, chainInfo, tx, cancel, bump)
+	if err != nil {
+		return "", err
+	}
+	return newTx.Hash().Hex(), nil
+}
+
+// replaceTx 使用相同 nonce 签名并发送替换 old 的交易，返回已签名的新交易
+// cancel 为 true 时发送给自己的 0 转账，否则与 old 的接收地址、金额、数据及 gas limit 相同
+func (c *Client) replaceTx(ctx context.Context, chain Chain, old *types.Transaction, cancel bool, bump int) (*types.Transaction, error) {
+	if bump == 0 {
+		bump = defaultFeeBump
+	}
+	if bump < minFeeBump {
+		return nil, fmt.Errorf("fee bump %d%% is below the %d%% replacement minimum", bump, minFeeBump)
+	}
+	account, err := c.signer()
+	if err != nil {
+		return nil, err
+	}
+	from := account.Address()
+	var tip, feeCap *big.Int
+	err = c.getConnectPool(chain).Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		tip, feeCap, err = suggestFees(ctx, c1)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	tip, feeCap = replacementFees(tip, feeCap, old, bump)
+	txData := &types.DynamicFeeTx{
+		ChainID:   old.ChainId(),
+		Nonce:     old.Nonce(),
+		To:        old.To(),
+		Value:     old.Value(),
+		Gas:       old.Gas(),
+		GasFeeCap: feeCap,
+		GasTipCap: tip,
+		Data:      old.Data(),
+	}
+	if cancel {
+		txData.To = &from
+		txData.Value = big.NewInt(0)
+		txData.Gas = cancelGasLimit
+		txData.Data = nil
+	}
+	// 只签名一次，切换 rpc 地址时重新发送同一笔交易
+	signedTx, err := account.SignTx(types.NewTx(txData), txData.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.sendSignedTx(ctx, chain, signedTx); err != nil {
+		return nil, err
+	}
+	action := "speed up"
+	if cancel {
+		action = "cancel"
+	}
+	c.logger.Printf("%s tx %s with %s nonce %d tip %s fee cap %s\n", action, old.Hash().Hex(), signedTx.Hash().Hex(),
+		signedTx.Nonce(), signedTx.GasTipCap(), signedTx.GasFeeCap())
+	return signedTx, nil
+}
+
+// replacementFees 替换交易的 GasTipCap 与 GasFeeCap：分别取当前建议值与 old 提高 bump% 后的较大值，GasFeeCap 不低于 GasTipCap
+// legacy 交易的 GasTipCap、GasFeeCap 都是 GasPrice
+func replacementFees(suggestedTip, suggestedFeeCap *big.Int, old *types.Transaction, bump int) (tip, feeCap *big.Int) {
+	tip = maxBig(suggestedTip, bumpFee(old.GasTipCap(), bump))
+	feeCap = maxBig(suggestedFeeCap, bumpFee(old.GasFeeCap(), bump))
+	if feeCap.Cmp(tip) < 0 {
+		feeCap = tip
+	}
+	return tip, feeCap
+}
+
+// bumpFee fee 提高 bump% 并向上取整
+func bumpFee(fee *big.Int, bump int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(int64(100+bump)))
+	bumped.Add(bumped, big.NewInt(99))
+	return bumped.Div(bumped, big.NewInt(100))
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
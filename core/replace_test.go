@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestBumpFee(t *testing.T) {
+	tests := []struct {
+		fee  int64
+		bump int
+		want int64
+	}{
+		{100, 10, 110},
+		{100, 12, 112},
+		{1000000001, 12, 1120000002}, // 向上取整，保证至少提高 bump%
+		{7, 10, 8},
+		{0, 12, 0},
+	}
+	for _, tt := range tests {
+		if got := bumpFee(big.NewInt(tt.fee), tt.bump); got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("bumpFee(%d, %d) = %s, want %d", tt.fee, tt.bump, got, tt.want)
+		}
+	}
+}
+
+func TestReplacementFees(t *testing.T) {
+	gwei := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9)) }
+	dynamic := types.NewTx(&types.DynamicFeeTx{GasTipCap: gwei(2), GasFeeCap: gwei(30)})
+	legacy := types.NewTx(&types.LegacyTx{GasPrice: gwei(20)})
+
+	tests := []struct {
+		name                          string
+		old                           *types.Transaction
+		suggestedTip, suggestedFeeCap *big.Int
+		bump                          int
+		wantTip, wantFeeCap           *big.Int
+	}{
+		{
+			name:         "bumped old fees above suggestion",
+			old:          dynamic,
+			suggestedTip: gwei(1), suggestedFeeCap: gwei(20),
+			bump:    12,
+			wantTip: big.NewInt(2240000000), wantFeeCap: big.NewInt(33600000000),
+		},
+		{
+			name:         "suggestion above bumped old fees",
+			old:          dynamic,
+			suggestedTip: gwei(5), suggestedFeeCap: gwei(80),
+			bump:    12,
+			wantTip: gwei(5), wantFeeCap: gwei(80),
+		},
+		{
+			name:         "tip and fee cap chosen independently",
+			old:          dynamic,
+			suggestedTip: gwei(3), suggestedFeeCap: gwei(20),
+			bump:    10,
+			wantTip: gwei(3), wantFeeCap: gwei(33),
+		},
+		{
+			name:         "fee cap raised to tip",
+			old:          dynamic,
+			suggestedTip: gwei(40), suggestedFeeCap: gwei(20),
+			bump:    10,
+			wantTip: gwei(40), wantFeeCap: gwei(40),
+		},
+		{
+			name:         "legacy gas price bumped for both",
+			old:          legacy,
+			suggestedTip: gwei(1), suggestedFeeCap: gwei(15),
+			bump:    10,
+			wantTip: gwei(22), wantFeeCap: gwei(22),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tip, feeCap := replacementFees(tt.suggestedTip, tt.suggestedFeeCap, tt.old, tt.bump)
+			if tip.Cmp(tt.wantTip) != 0 || feeCap.Cmp(tt.wantFeeCap) != 0 {
+				t.Fatalf("tip %s fee cap %s, want %s and %s", tip, feeCap, tt.wantTip, tt.wantFeeCap)
+			}
+			// 节点要求替换交易的两项 gas 费都至少提高 10%
+			if tip.Cmp(bumpFee(tt.old.GasTipCap(), minFeeBump)) < 0 || feeCap.Cmp(bumpFee(tt.old.GasFeeCap(), minFeeBump)) < 0 {
+				t.Fatalf("tip %s fee cap %s below the replacement minimum", tip, feeCap)
+			}
+		})
+	}
+}
+
+func TestReplaceTxRejectsSmallBump(t *testing.T) {
+	c := &Client{}
+	old := types.NewTx(&types.DynamicFeeTx{GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(1)})
+	if _, err := c.replaceTx(context.Background(), Chain{}, old, false, minFeeBump-1); err == nil {
+		t.Fatal("fee bump below the replacement minimum accepted")
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultSameChainSlippage  = 0.005
+	defaultCrossChainSlippage = 0.01
+	maxSlippage               = 0.5
+	defaultSwapDeadline       = time.Hour
+)
+
+var (
+	errInvalidSlippage = errors.New("invalid slippage")
+	errInvalidDeadline = errors.New("invalid deadline")
+)
+
+// SwapRequest 一次 swap 请求
+type SwapRequest struct {
+	FromChain string // 链名或 chain id，为空时使用默认链
+	ToChain   string
+	FromToken string // token symbol 或 erc20 合约地址
+	ToToken   string
+	Amount    Amount // 为空时使用 token 配置的默认数量
+	Receiver  string // 目标链接收地址，为空时为签名账户地址
+
+	// Slippage 滑点，0.01 表示 1%，为 0 时单链 swap 使用 0.5%，跨链使用 1%
+	Slippage float64
+	// Deadline uniswap swap 交易的有效期，为 0 时使用 1 小时
+	Deadline time.Duration
+}
+
+// Validate 校验 swap 参数
+func (r SwapRequest) Validate() error {
+	// NaN 不满足任何比较，需要单独排除，否则计算最小输出数量时 decimal 会 panic
+	if math.IsNaN(r.Slippage) || math.IsInf(r.Slippage, 0) || r.Slippage < 0 || r.Slippage > maxSlippage {
+		return fmt.Errorf("%w: %v, should be in [0, %v]", errInvalidSlippage, r.Slippage, maxSlippage)
+	}
+	if r.Receiver != "" && !common.IsHexAddress(r.Receiver) {
+		return fmt.Errorf("invalid receiver %s", r.Receiver)
+	}
+	if r.Deadline < 0 {
+		return fmt.Errorf("%w: %s", errInvalidDeadline, r.Deadline)
+	}
+	return nil
+}
+
+func (r SwapRequest) slippage(defaultSlippage float64) float64 {
+	if r.Slippage == 0 {
+		return defaultSlippage
+	}
+	return r.Slippage
+}
+
+// deadline 返回 uniswap deadline 的时间点
+func (r SwapRequest) deadline() time.Time {
+	if r.Deadline == 0 {
+		return time.Now().Add(defaultSwapDeadline)
+	}
+	return time.Now().Add(r.Deadline)
+}
+
+func swapOptionsString(slippage float64, deadline time.Time) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "swap options:")
+	fmt.Fprintf(&b, "Slippage:           %.2f%%\n", slippage*100)
+	fmt.Fprintf(&b, "Deadline:           %s (%d)\n", deadline.Format(time.RFC3339), deadline.Unix())
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	revertErrorName = "Error" // require(false, "reason") 产生的 Error(string)
+	revertPanicName = "Panic" // assert 等产生的 Panic(uint256)
+)
+
+var (
+	uint256Type, _ = abi.NewType("uint256", "", nil)
+
+	revertErrorSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	revertPanicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// SoDiamond 中没有参数的自定义错误，可以使用 errors.Is 判断
+var (
+	ErrCannotBridgeToSameNetwork  = &ContractError{Name: "CannotBridgeToSameNetwork"}
+	ErrContractCallNotAllowed     = &ContractError{Name: "ContractCallNotAllowed"}
+	ErrInvalidAmount              = &ContractError{Name: "InvalidAmount"}
+	ErrInvalidConfig              = &ContractError{Name: "InvalidConfig"}
+	ErrInvalidContract            = &ContractError{Name: "InvalidContract"}
+	ErrNativeAssetTransferFailed  = &ContractError{Name: "NativeAssetTransferFailed"}
+	ErrNoSwapDataProvided         = &ContractError{Name: "NoSwapDataProvided"}
+	ErrNoSwapFromZeroBalance      = &ContractError{Name: "NoSwapFromZeroBalance"}
+	ErrNoTransferToNullAddress    = &ContractError{Name: "NoTransferToNullAddress"}
+	ErrNullAddrIsNotAValidSpender = &ContractError{Name: "NullAddrIsNotAValidSpender"}
+	ErrNullAddrIsNotAnERC20Token  = &ContractError{Name: "NullAddrIsNotAnERC20Token"}
+	ErrReentrancyError            = &ContractError{Name: "ReentrancyError"}
+	ErrWithdrawFailed             = &ContractError{Name: "WithdrawFailed"}
+)
+
+// ContractError 合约 revert 的错误，根据 revert data 与 abi 中的 error selector 解析
+// 可以通过 errors.As 获取，Unwrap 返回 rpc 返回的原始错误
+type ContractError struct {
+	Name   string        // 自定义错误名，require 的 revert reason 为 Error，assert 为 Panic
+	Args   []interface{} // 错误参数
+	Reason string        // Error(string) 的 revert reason
+	Data   []byte        // 原始 revert data
+	Err    error         // rpc 返回的原始错误
+}
+
+func (e *ContractError) Error() string {
+	switch {
+	case e.Name == revertErrorName:
+		return "execution reverted: " + e.Reason
+	case len(e.Args) == 0:
+		return "execution reverted: " + e.Name
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = fmt.Sprint(arg)
+	}
+	return fmt.Sprintf("execution reverted: %s(%s)", e.Name, strings.Join(args, ", "))
+}
+
+func (e *ContractError) Unwrap() error {
+	return e.Err
+}
+
+// Is 按错误名匹配 ErrInvalidAmount 等没有参数的错误
+func (e *ContractError) Is(target error) bool {
+	t, ok := target.(*ContractError)
+	return ok && t.Data == nil && t.Name == e.Name
+}
+
+// NotEnoughBalance SoDiamond NotEnoughBalance(uint256 requested, uint256 available)
+type NotEnoughBalance struct {
+	*ContractError
+	Requested *big.Int
+	Available *big.Int
+}
+
+func (e *NotEnoughBalance) Unwrap() error {
+	return e.ContractError
+}
+
+// typedErrors 带参数的自定义错误转换成对应的类型
+var typedErrors = map[string]func(e *ContractError) error{
+	"NotEnoughBalance": func(e *ContractError) error {
+		if len(e.Args) != 2 {
+			return e
+		}
+		requested, _ := e.Args[0].(*big.Int)
+		available, _ := e.Args[1].(*big.Int)
+		return &NotEnoughBalance{ContractError: e, Requested: requested, Available: available}
+	},
+}
+
+// revertData 从 rpc 错误中取出 revert data，节点通过 json-rpc error 的 data 字段返回
+func revertData(err error) ([]byte, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil, false
+	}
+	switch data := dataErr.ErrorData().(type) {
+	case string:
+		b, err := hexutil.Decode(data)
+		if err != nil {
+			return nil, false
+		}
+		return b, true
+	case []byte:
+		return data, true
+	}
+	return nil, false
+}
+
+// revertError 把 EstimateGas、CallContract 返回的错误解析成 ContractError 或对应的类型
+// 没有 revert data 或者无法解析时返回原始错误
+func revertError(err error, abis ...*abi.ABI) error {
+	if err == nil {
+		return nil
+	}
+	var contractErr *ContractError
+	if errors.As(err, &contractErr) {
+		return err
+	}
+	data, ok := revertData(err)
+	if !ok || len(data) < 4 {
+		return err
+	}
+	contractErr = &ContractError{Data: data, Err: err}
+	selector := data[:4]
+	switch {
+	case bytes.Equal(selector, revertErrorSelector):
+		reason, unpackErr := abi.UnpackRevert(data)
+		if unpackErr != nil {
+			return err
+		}
+		contractErr.Name = revertErrorName
+		contractErr.Reason = reason
+		return contractErr
+	case bytes.Equal(selector, revertPanicSelector):
+		args, unpackErr := (abi.Arguments{{Type: uint256Type}}).Unpack(data[4:])
+		if unpackErr != nil {
+			return err
+		}
+		contractErr.Name = revertPanicName
+		contractErr.Args = args
+		return contractErr
+	}
+	for _, a := range abis {
+		for _, abiErr := range a.Errors {
+			if !bytes.Equal(selector, abiErr.ID[:4]) {
+				continue
+			}
+			unpacked, unpackErr := abiErr.Unpack(data)
+			if unpackErr != nil {
+				return err
+			}
+			contractErr.Name = abiErr.Name
+			contractErr.Args, _ = unpacked.([]interface{})
+			if typed, ok := typedErrors[abiErr.Name]; ok {
+				return typed(contractErr)
+			}
+			return contractErr
+		}
+	}
+	return err
+}
+
+// revertError 使用合约自身的 abi 解析 revert 错误
+func (c *baseContract) revertError(err error) error {
+	return revertError(err, c.Abi)
+}
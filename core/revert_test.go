@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	soabi "so-omnichain-example/abi"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// testDataError 节点返回的带 revert data 的 json-rpc 错误
+type testDataError struct {
+	data interface{}
+}
+
+func (e testDataError) Error() string          { return "execution reverted" }
+func (e testDataError) ErrorCode() int         { return 3 }
+func (e testDataError) ErrorData() interface{} { return e.data }
+
+func testAbis(t *testing.T) *abiSet {
+	t.Helper()
+	abis, err := loadAbis(soabi.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abis
+}
+
+func packRevert(t *testing.T, selector []byte, args abi.Arguments, values ...interface{}) []byte {
+	t.Helper()
+	packed, err := args.Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(append([]byte{}, selector...), packed...)
+}
+
+func TestRevertError(t *testing.T) {
+	abis := testAbis(t)
+	stringType, _ := abi.NewType("string", "", nil)
+	notEnough := abis.diamond.Errors["NotEnoughBalance"]
+	invalidAmount := abis.diamond.Errors["InvalidAmount"]
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		wantName string // 为空时期望返回原始错误
+		wantMsg  string
+		check    func(t *testing.T, err error)
+	}{
+		{
+			name:     "Error(string)",
+			data:     hexutil.Encode(packRevert(t, revertErrorSelector, abi.Arguments{{Type: stringType}}, "UniswapV2Router: EXPIRED")),
+			wantName: revertErrorName,
+			wantMsg:  "execution reverted: UniswapV2Router: EXPIRED",
+			check: func(t *testing.T, err error) {
+				var contractErr *ContractError
+				errors.As(err, &contractErr)
+				if contractErr.Reason != "UniswapV2Router: EXPIRED" {
+					t.Fatalf("reason = %q", contractErr.Reason)
+				}
+			},
+		},
+		{
+			name:     "Panic(uint256)",
+			data:     hexutil.Encode(packRevert(t, revertPanicSelector, abi.Arguments{{Type: uint256Type}}, big.NewInt(0x11))),
+			wantName: revertPanicName,
+			wantMsg:  "execution reverted: Panic(17)",
+		},
+		{
+			name:     "custom error with arguments",
+			data:     hexutil.Encode(packRevert(t, notEnough.ID[:4], notEnough.Inputs, big.NewInt(100), big.NewInt(40))),
+			wantName: "NotEnoughBalance",
+			wantMsg:  "execution reverted: NotEnoughBalance(100, 40)",
+			check: func(t *testing.T, err error) {
+				var typed *NotEnoughBalance
+				if !errors.As(err, &typed) {
+					t.Fatalf("errors.As NotEnoughBalance failed for %v", err)
+				}
+				if typed.Requested.Cmp(big.NewInt(100)) != 0 || typed.Available.Cmp(big.NewInt(40)) != 0 {
+					t.Fatalf("requested %s available %s, want 100 and 40", typed.Requested, typed.Available)
+				}
+				if errors.Is(err, ErrInvalidAmount) {
+					t.Fatal("NotEnoughBalance matches ErrInvalidAmount")
+				}
+			},
+		},
+		{
+			name:     "custom error without arguments",
+			data:     invalidAmount.ID[:4],
+			wantName: "InvalidAmount",
+			wantMsg:  "execution reverted: InvalidAmount",
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("errors.Is ErrInvalidAmount failed for %v", err)
+				}
+				if errors.Is(err, ErrInvalidConfig) {
+					t.Fatal("InvalidAmount matches ErrInvalidConfig")
+				}
+				var typed *NotEnoughBalance
+				if errors.As(err, &typed) {
+					t.Fatal("InvalidAmount converted to NotEnoughBalance")
+				}
+			},
+		},
+		{name: "unknown selector", data: "0xdeadbeef0000000000000000000000000000000000000000000000000000000000000001"},
+		{name: "short data", data: "0x0102"},
+		{name: "invalid hex", data: "0xzz"},
+		{name: "truncated arguments", data: hexutil.Encode(append(notEnough.ID[:4:4], make([]byte, 32)...))},
+		{name: "truncated reason", data: hexutil.Encode(append(revertErrorSelector[:4:4], make([]byte, 20)...))},
+		{name: "no data", data: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := &testDataError{data: tt.data}
+			err := revertError(orig, abis.diamond)
+			if !errors.Is(err, orig) {
+				t.Fatalf("original rpc error lost: %v", err)
+			}
+			var contractErr *ContractError
+			if tt.wantName == "" {
+				if errors.As(err, &contractErr) {
+					t.Fatalf("decoded %s, want the original error", contractErr.Name)
+				}
+				return
+			}
+			if !errors.As(err, &contractErr) {
+				t.Fatalf("err %v is not a ContractError", err)
+			}
+			if contractErr.Name != tt.wantName {
+				t.Fatalf("name = %s, want %s", contractErr.Name, tt.wantName)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Fatalf("message = %q, want %q", err.Error(), tt.wantMsg)
+			}
+			if tt.check != nil {
+				tt.check(t, err)
+			}
+		})
+	}
+}
+
+func TestRevertErrorPassThrough(t *testing.T) {
+	abis := testAbis(t)
+	if revertError(nil, abis.diamond) != nil {
+		t.Fatal("nil error converted")
+	}
+
+	// 已经解析过的错误原样返回
+	notEnough := abis.diamond.Errors["NotEnoughBalance"]
+	data := packRevert(t, notEnough.ID[:4], notEnough.Inputs, big.NewInt(1), big.NewInt(0))
+	decoded := revertError(&testDataError{data: data}, abis.diamond)
+	if again := revertError(decoded, abis.diamond); again != decoded {
+		t.Fatalf("decoded error converted again: %v", again)
+	}
+
+	// 只在传入的 abi 中查找自定义错误
+	plain := &testDataError{data: data}
+	if err := revertError(plain, abis.erc20); err != error(plain) {
+		t.Fatalf("custom error decoded without its abi: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"so-omnichain-example/connpool"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// wsFallbackPollInterval websocket 订阅时仍然按此间隔轮询，防止订阅没有报错但停止推送
+const wsFallbackPollInterval = 30 * time.Second
+
+// maxLogBlockRange 单次 eth_getLogs 查询的最大块数，大多数 rpc 服务商都有限制
+const maxLogBlockRange = 2000
+
+// isWebsocket rpc 地址是否是 websocket，websocket 可以使用 eth_subscribe
+func isWebsocket(rawUrl string) bool {
+	rawUrl = strings.ToLower(rawUrl)
+	return strings.HasPrefix(rawUrl, "ws://") || strings.HasPrefix(rawUrl, "wss://")
+}
+
+// websocketEndpoints 返回链上所有 websocket rpc 地址，按优先级排序
+func websocketEndpoints(chain Chain) []string {
+	endpoints := chain.Endpoints()
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	var urls []string
+	for _, e := range endpoints {
+		if isWebsocket(e.Url) {
+			urls = append(urls, e.Url)
+		}
+	}
+	return urls
+}
+
+// dialSubscription 为订阅单独建立连接，订阅期间连接不能归还连接池
+// 依次尝试链上的 websocket 地址，没有 websocket 地址时返回 rpc.ErrNotificationsUnsupported
+// 连接记录在 Client 中，用完后通过 closeSubscription 关闭，Shutdown 时关闭所有未关闭的连接
+func (c *Client) dialSubscription(ctx context.Context, chain Chain) (*ethclient.Client, error) {
+	err := rpc.ErrNotificationsUnsupported
+	for _, url := range websocketEndpoints(chain) {
+		var client *rpc.Client
+		client, err = rpc.DialContext(ctx, url)
+		if err == nil {
+			ethClient := ethclient.NewClient(client)
+			c.connMapLock.Lock()
+			defer c.connMapLock.Unlock()
+			if c.closed {
+				ethClient.Close()
+				return nil, connpool.ErrPoolClosed
+			}
+			c.subs[ethClient] = true
+			return ethClient, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) closeSubscription(client *ethclient.Client) {
+	c.connMapLock.Lock()
+	delete(c.subs, client)
+	c.connMapLock.Unlock()
+	client.Close()
+}
+
+// newBlockNotifier 每出一个新块向返回的 channel 发送一次通知
+// websocket 使用 newHeads 订阅，订阅失败或 http 地址按 interval 轮询
+// ctx 结束后停止
+func (c *Client) newBlockNotifier(ctx context.Context, chain Chain, interval time.Duration) <-chan struct{} {
+	pollInterval := interval
+	notify := make(chan struct{}, 1)
+	send := func() {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+
+	var (
+		heads  chan *types.Header
+		sub    ethereum.Subscription
+		client *ethclient.Client
+	)
+	if len(websocketEndpoints(chain)) > 0 {
+		var err error
+		client, err = c.dialSubscription(ctx, chain)
+		if err == nil {
+			heads = make(chan *types.Header, 16)
+			sub, err = client.SubscribeNewHead(ctx, heads)
+			if err != nil {
+				c.closeSubscription(client)
+			}
+		}
+		if err != nil {
+			c.logger.Printf("subscribe newHeads on %s failed, polling instead: %s\n", chain.Name, err)
+			sub = nil
+		} else {
+			interval = wsFallbackPollInterval
+		}
+	}
+
+	go func() {
+		if sub != nil {
+			defer c.closeSubscription(client)
+			defer sub.Unsubscribe()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var subErr <-chan error
+		if sub != nil {
+			subErr = sub.Err()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heads:
+				send()
+			case err := <-subErr:
+				// 订阅断开后回退到轮询
+				c.logger.Printf("newHeads subscription on %s closed, polling instead: %v\n", chain.Name, err)
+				subErr, heads = nil, nil
+				ticker.Reset(pollInterval)
+			case <-ticker.C:
+				send()
+			}
+		}
+	}()
+	return notify
+}
+
+// WatchDiamondLogs 从 fromBlock 开始查找 chain 上 SoDiamond 合约符合 topics 的日志，依次交给 handle 处理
+// handle 返回 true 或者返回错误时停止，websocket rpc 地址会订阅日志实时推送
+func (c *Client) WatchDiamondLogs(ctx context.Context, chain string, fromBlock uint64, topics [][]common.Hash, handle func(types.Log) (bool, error)) error {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return err
+	}
+	return c.watchDiamondLogs(ctx, chainInfo, fromBlock, topics, c.watch.withDefaults().PollInterval, handle)
+}
+
+// watchDiamondLogs 从 fromBlock 开始查找 chain 上 SoDiamond 合约符合 topics 的日志，依次交给 handle 处理
+// handle 返回 true 或者返回错误时停止，ctx 结束时返回 ctx 的错误
+// websocket 使用 logs 订阅实时获取新日志，http 按 interval 轮询 eth_getLogs
+func (c *Client) watchDiamondLogs(ctx context.Context, chain Chain, fromBlock uint64, topics [][]common.Hash, interval time.Duration, handle func(types.Log) (bool, error)) error {
+	pollInterval := interval
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(chain.SoDiamond)},
+		Topics:    topics,
+	}
+
+	// 先订阅再补查历史日志，避免两者之间的日志丢失，重复的日志按 (tx hash, index) 去重
+	var (
+		logs   chan types.Log
+		subErr <-chan error
+	)
+	if len(websocketEndpoints(chain)) > 0 {
+		client, err := c.dialSubscription(ctx, chain)
+		if err == nil {
+			logs = make(chan types.Log, 64)
+			var sub ethereum.Subscription
+			sub, err = client.SubscribeFilterLogs(ctx, query, logs)
+			if err == nil {
+				defer c.closeSubscription(client)
+				defer sub.Unsubscribe()
+				subErr = sub.Err()
+				interval = wsFallbackPollInterval
+			} else {
+				c.closeSubscription(client)
+				logs = nil
+			}
+		}
+		if err != nil {
+			c.logger.Printf("subscribe logs on %s failed, polling instead: %s\n", chain.Name, err)
+		}
+	}
+
+	type logKey struct {
+		tx    common.Hash
+		index uint
+	}
+	seen := make(map[logKey]bool)
+	deliver := func(l types.Log) (bool, error) {
+		key := logKey{l.TxHash, l.Index}
+		if l.Removed || seen[key] {
+			return false, nil
+		}
+		seen[key] = true
+		return handle(l)
+	}
+
+	pool := c.getConnectPool(chain)
+	next := fromBlock
+	scan := func() (bool, error) {
+		var found []types.Log
+		err := pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			latest, err := c1.BlockNumber(ctx)
+			if err != nil {
+				return err
+			}
+			for next <= latest {
+				to := next + maxLogBlockRange - 1
+				if to > latest {
+					to = latest
+				}
+				q := query
+				q.FromBlock = new(big.Int).SetUint64(next)
+				q.ToBlock = new(big.Int).SetUint64(to)
+				logs, err := c1.FilterLogs(ctx, q)
+				if err != nil {
+					return err
+				}
+				found = append(found, logs...)
+				next = to + 1
+			}
+			return nil
+		})
+		// 已经查到的日志先处理，rpc 错误在下次轮询时重试
+		for _, l := range found {
+			if done, err := deliver(l); done || err != nil {
+				return true, err
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	errCount := 0
+	for {
+		done, err := scan()
+		if done {
+			return err
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, connpool.ErrPoolClosed) {
+			return err
+		}
+		if err != nil {
+			errCount++
+			if errCount >= maxWatchErrors {
+				return err
+			}
+			c.logger.Printf("get logs on %s: %s\n", chain.Name, err)
+		} else {
+			errCount = 0
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case l := <-logs:
+				if done, err := deliver(l); done || err != nil {
+					return err
+				}
+			case err := <-subErr:
+				c.logger.Printf("logs subscription on %s closed, polling instead: %v\n", chain.Name, err)
+				logs, subErr = nil, nil
+				ticker.Reset(pollInterval)
+			case <-ticker.C:
+				break wait
+			}
+		}
+	}
+}
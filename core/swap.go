@@ -5,17 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"os"
-	"so-omnichain-example/display"
+	"strings"
 	"time"
 
-	"github.com/coming-chat/wallet-SDK/core/eth"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/fatih/color"
 	"github.com/shopspring/decimal"
-	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -23,217 +20,130 @@ const (
 	zeroAddressNoPrefix = "0000000000000000000000000000000000000000"
 )
 
-var (
-	usdcDecimal *big.Int
-	ethDecimal  *big.Int
-	usdcAmount  *big.Int
-	ethAmount   *big.Int
-)
-
-var config Config
-var account *eth.Account
-
-func initConfig() {
-	data, err := os.ReadFile("./config.yaml")
+// Swap 用 req.Amount 数量的 fromToken 兑换 toChain 上的 toToken，ctx 限制预估、发送及等待上链的全过程
+func (c *Client) Swap(ctx context.Context, req SwapRequest) error {
+	account, err := c.signer()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		panic(err)
+	if req.Receiver == "" {
+		req.Receiver = account.Address().Hex()
 	}
-
-	// load account
-	account, err = eth.NewAccountWithMnemonic(os.Getenv("words"))
+	req, sameChain, err := c.resolveRequest(req)
 	if err != nil {
-		panic(err)
+		return err
 	}
-}
-
-func init() {
-	initConfig()
-
-	usdcDecimal, _ = big.NewInt(0).SetString("1000000", 10)            // 1e6
-	ethDecimal, _ = big.NewInt(0).SetString("1000000000000000000", 10) // 1e18
-	usdcAmount = big.NewInt(0).Mul(big.NewInt(10), usdcDecimal)        // 10 usdc
-	ethAmount = big.NewInt(0).Mul(
-		big.NewInt(0).Div(ethDecimal, big.NewInt(100)),
-		big.NewInt(2),
-	) // 2*1e-2
-}
-
-func Swap(fromChain, toChain, fromToken, toToken string) error {
-	if fromChain == toChain {
-		return swapSameChain(fromChain, fromToken, toToken)
+	if sameChain {
+		return c.swapSameChain(ctx, req)
 	}
-	return swapDiffChain(fromChain, toChain, fromToken, toToken)
+	return c.swapDiffChain(ctx, req)
 }
 
-func swapDiffChain(fromChain, toChain, fromToken, toToken string) error {
-	txSendValue := big.NewInt(0)
-	fromChainInfo, fromTokenAddress, testAmount, err := getChainAndToken(fromChain, fromToken)
-	if err != nil {
-		return err
-	}
-	toChainInfo, toTokenAddress, _, err := getChainAndToken(toChain, toToken)
-	if err != nil {
-		return err
-	}
-	soData := newSoData(account.Address(), fromChainInfo.ChainId, fromTokenAddress, toChainInfo.ChainId, toTokenAddress, testAmount)
-	srcSwapData := make([]SwapData, 0)
-	var srcUniswapPath []common.Address
-	dstSwapData := make([]SwapData, 0)
-	var dstUniswapPath []common.Address
-	// stargate 跨链仅支持 usdc usdt stargate
-	if fromTokenAddress != fromChainInfo.Usdc {
-		srcSwapData, srcUniswapPath, err = createSwapData(fromChainInfo, fromTokenAddress, fromChainInfo.Usdc, testAmount, big.NewInt(0))
-		if err != nil {
-			return err
-		}
-	}
-	if fromTokenAddress == zeroAddress {
-		txSendValue = big.NewInt(0).Add(txSendValue, testAmount)
-	}
-	if toTokenAddress != toChainInfo.Usdc {
-		// 发交易前需要重新生成
-		// dstSwap 的 fromAmount 填 0 即可，合约会自动填入
-		dstSwapData, dstUniswapPath, err = createSwapData(toChainInfo, toChainInfo.Usdc, toTokenAddress, big.NewInt(0), big.NewInt(0))
-		if err != nil {
-			return err
-		}
+// resolveRequest 校验请求，并把链参数统一转成链名
+func (c *Client) resolveRequest(req SwapRequest) (SwapRequest, bool, error) {
+	if err := req.Validate(); err != nil {
+		return req, false, err
 	}
-
-	// 1. 估算目标链交易需要的 dst gas fee，此手续费用来计算 stargate 跨链的总体手续费
-	dstGasUint64, err := estimateForGas(toChainInfo, soData, dstSwapData)
+	fromChainInfo, err := c.getChainInfo(req.FromChain)
 	if err != nil {
-		return err
+		return req, false, err
 	}
-	dstGas := big.NewInt(int64(dstGasUint64))
-	display.PrintfWithTime("sgReceive 预估手续费：%s\n", dstGas)
-	stargateData := newStargateData(fromChainInfo, toChainInfo, big.NewInt(0), dstGas)
-
-	// 从源链获取 stargate cross fee，并计算发给 sodiamond 的 value
-	// 2. 预估最终得到的 final amount
-	finalAmount, err := estimateFinalAmount(fromChainInfo, testAmount, srcUniswapPath, stargateData, toChainInfo, dstUniswapPath)
+	toChainInfo, err := c.getChainInfo(req.ToChain)
 	if err != nil {
-		return err
+		return req, false, err
 	}
+	req.FromChain = fromChainInfo.Name
+	req.ToChain = toChainInfo.Name
+	return req, fromChainInfo.Name == toChainInfo.Name, nil
+}
 
-	// 3. 根据滑点预估 stargate 发送到目标链的 min amount，并重新构造 dstSwapData
-	slippage := 0.01
-	minAmount, stargateMinAmount, err := estimateMinAmount(toChainInfo, finalAmount, float32(slippage), dstUniswapPath)
+func (c *Client) swapDiffChain(ctx context.Context, req SwapRequest) error {
+	route, err := c.planDiffChain(ctx, req)
 	if err != nil {
 		return err
 	}
-	stargateData.MinAmount = stargateMinAmount
-	display.PrintfWithTime("amountOut: %s  amountMinOut: %s\n", finalAmount, minAmount)
-	display.PrintfWithTime("stargate min amount: %s\n", stargateData.MinAmount)
-	if toTokenAddress != toChainInfo.Usdc {
-		dstSwapData, _, err = createSwapData(toChainInfo, toChainInfo.Usdc, toTokenAddress, big.NewInt(0), minAmount)
-		if err != nil {
-			return err
-		}
-	}
+	fromChainInfo := route.fromChain
+	fromTokenInfo := route.quote.FromToken
 
 	// 4. 发送交易
-	if fromTokenAddress != zeroAddress {
+	if !fromTokenInfo.Native {
 		// 4.1 如果 from token 是 erc20，则需要先 approve
-		approvedTxHash, err := approve(fromChainInfo, fromTokenAddress, fromChainInfo.SoDiamond, testAmount)
+		approvedTxHash, err := c.approve(ctx, fromChainInfo, fromTokenInfo.Address, fromChainInfo.SoDiamond, route.quote.AmountIn)
 		if err != nil {
 			return err
 		}
 		if approvedTxHash == "" {
 			return errors.New("approve failed")
 		}
-		err = waitForTxSuccess(fromChainInfo.Rpc, approvedTxHash)
+		_, err = c.waitForTxSuccess(ctx, fromChainInfo, approvedTxHash)
 		if err != nil {
 			return err
 		}
 	}
-	// 4.1 计算 stargateFee，跟 value 相加作为最后发送的 value
-	stargateFee, err := getStargateFee(fromChainInfo, soData, stargateData, dstSwapData)
-	if err != nil {
-		return err
-	}
-	display.PrintfWithTime("get stargate fee: %s eth\n", decimal.NewFromBigInt(stargateFee, 0).Div(decimal.NewFromBigInt(ethDecimal, 0)).StringFixed(8))
-	txSendValue = big.NewInt(0).Add(txSendValue, stargateFee)
-
-	soData.print()
-	stargateData.print()
-	fmt.Println("===========================================================")
-	fmt.Printf("value:            %s\n", txSendValue)
-	txHash, err := soSwapViaStargate(fromChainInfo, soData, srcSwapData, stargateData, dstSwapData, txSendValue)
-	if err != nil {
-		return err
-	}
-	display.PrintfWithTime("txHash: %s\n", txHash)
-	err = waitForTxSuccess(fromChainInfo.Rpc, txHash)
-	if err != nil {
-		return err
-	}
 
-	return nil
-}
-
-func swapSameChain(chain, fromToken, toToken string) error {
-	if fromToken == toToken {
-		return nil
-	}
-	// 获取当前执行环境
-	chainInfo, fromTokenAddress, testAmount, err := getChainAndToken(chain, fromToken)
+	c.logger.Printf("%s", route.soData.String())
+	c.logger.Printf("%s", route.stargateData.String())
+	c.logger.Printf("%s", swapOptionsString(route.quote.Slippage, route.quote.Deadline))
+	c.logger.Printf("value:            %s\n", route.quote.Value)
+	txHash, err := c.soSwapViaStargate(ctx, fromChainInfo, route.soData, route.srcSwapData, route.stargateData, route.dstSwapData, route.quote.Value)
 	if err != nil {
 		return err
 	}
-	_, toTokenAddress, _, err := getChainAndToken(chain, toToken)
+	c.logger.Printf("txHash: %s\n", txHash)
+	result, err := c.waitForTxSuccess(ctx, fromChainInfo, txHash)
 	if err != nil {
 		return err
 	}
 
-	// 构造基本的数据结构
-	soData := newSoData(account.Address(), chainInfo.ChainId, fromTokenAddress, chainInfo.ChainId, toTokenAddress, testAmount)
-	// 构造 uniswapPath，生产环境下应按照 pair 库存寻找最佳路径
-	_, uniswapPath, err := createSwapData(chainInfo, fromTokenAddress, toTokenAddress, testAmount, big.NewInt(0))
+	// 5. 等待目标链到账
+	transfer, err := c.trackDelivery(ctx, fromChainInfo, result)
 	if err != nil {
 		return err
 	}
-	txSendValue := big.NewInt(0)
-	if fromTokenAddress == zeroAddress {
-		txSendValue = big.NewInt(0).Add(txSendValue, testAmount)
+	c.logger.Printf("%s", transfer.String())
+	if transfer.Status == TransferFailed {
+		return fmt.Errorf("cross chain transfer failed: %s", transfer.RevertReason)
 	}
+	c.logger.Printf("%s\n", color.HiGreenString("received %s %s on %s in %s",
+		formatAmount(transfer.ReceiveAmount, route.quote.ToToken.Decimals), route.quote.ToToken.Symbol, transfer.ToChain, transfer.Latency))
+	return nil
+}
 
-	// 1. 根据滑点计算 minAmount，构造 swapData
-	_, amountMinOut, err := estimateUniswapAmount(chainInfo, testAmount, 0.005, uniswapPath)
+func (c *Client) swapSameChain(ctx context.Context, req SwapRequest) error {
+	route, err := c.planSameChain(ctx, req)
 	if err != nil {
 		return err
 	}
-	swapData, _, err := createSwapData(chainInfo, fromTokenAddress, toTokenAddress, testAmount, amountMinOut)
-	if err != nil {
-		return err
+	if route == nil {
+		return nil
 	}
+	chainInfo := route.fromChain
+	fromTokenInfo := route.quote.FromToken
+	c.logger.Printf("%s", swapOptionsString(route.quote.Slippage, route.quote.Deadline))
 
 	// 2. 如果 from token 是 erc20，需要先 approve
-	if fromTokenAddress != zeroAddress {
+	if !fromTokenInfo.Native {
 		// 2.1 如果 from token 是 erc20，则需要先 approve
-		approvedTxHash, err := approve(chainInfo, fromTokenAddress, chainInfo.SoDiamond, testAmount)
+		approvedTxHash, err := c.approve(ctx, chainInfo, fromTokenInfo.Address, chainInfo.SoDiamond, route.quote.AmountIn)
 		if err != nil {
 			return err
 		}
 		if approvedTxHash == "" {
 			return errors.New("approve failed")
 		}
-		err = waitForTxSuccess(chainInfo.Rpc, approvedTxHash)
+		_, err = c.waitForTxSuccess(ctx, chainInfo, approvedTxHash)
 		if err != nil {
 			return err
 		}
 	}
 
 	// 3. 调用 sodiamond 合约 swapTokensGeneric
-	txHash, err := swapTokensGeneric(chainInfo, soData, swapData, txSendValue)
+	txHash, err := c.swapTokensGeneric(ctx, chainInfo, route.soData, route.srcSwapData, route.quote.Value)
 	if err != nil {
 		return err
 	}
-	display.PrintfWithTime("txHash: %s\n", txHash)
-	err = waitForTxSuccess(chainInfo.Rpc, txHash)
+	c.logger.Printf("txHash: %s\n", txHash)
+	_, err = c.waitForTxSuccess(ctx, chainInfo, txHash)
 	if err != nil {
 		return err
 	}
@@ -241,8 +151,8 @@ func swapSameChain(chain, fromToken, toToken string) error {
 	return nil
 }
 
-func createSwapData(chainInfo Chain, fromTokenAddress, toTokenAddress string, fromAmount, minAmount *big.Int) ([]SwapData, []common.Address, error) {
-	swapItem, path, err := newSwapData(chainInfo, fromTokenAddress, toTokenAddress, fromAmount, minAmount)
+func (c *Client) createSwapData(chainInfo Chain, fromTokenAddress, toTokenAddress string, fromAmount, minAmount *big.Int, deadline time.Time) ([]SwapData, []common.Address, error) {
+	swapItem, path, err := c.newSwapData(chainInfo, fromTokenAddress, toTokenAddress, fromAmount, minAmount, deadline)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -250,115 +160,90 @@ func createSwapData(chainInfo Chain, fromTokenAddress, toTokenAddress string, fr
 }
 
 // swapTokensGeneric 调用 soDiamond 合约，完成单链 swap
-func swapTokensGeneric(chain Chain, soData SoData, srcSwapDataList []SwapData, value *big.Int) (string, error) {
-	pool := getConnectPool(chain.Rpc)
-	var err error
-	var txHash string
-	err = pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-		txHash, err = newDiamondContract(common.HexToAddress(chain.SoDiamond)).
-			SwapTokensGeneric(chain.Rpc, c1, account, soData, srcSwapDataList, value)
-		return err
-	})
-	return txHash, err
+func (c *Client) swapTokensGeneric(ctx context.Context, chain Chain, soData SoData, srcSwapDataList []SwapData, value *big.Int) (string, error) {
+	account, err := c.signer()
+	if err != nil {
+		return "", err
+	}
+	msg, err := newDiamondContract(c.abis, common.HexToAddress(chain.SoDiamond)).
+		PackSwapTokensGeneric(account.Address(), soData, srcSwapDataList)
+	if err != nil {
+		return "", err
+	}
+	txHash, err := c.sendTx(ctx, chain, account, msg, value)
+	return txHash, revertError(err, c.abis.diamond)
 }
 
 // soSwapViaStargate 调用 soDiamond 合约，通过 stargate 跨链兑换
-func soSwapViaStargate(srcChain Chain, soData SoData, srcSwapDataList []SwapData, stargateData StargateData, dstSwapDataList []SwapData, value *big.Int) (string, error) {
-	pool := getConnectPool(srcChain.Rpc)
-	var err error
-	var txHash string
-	err = pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-		txHash, err = newDiamondContract(common.HexToAddress(srcChain.SoDiamond)).
-			SoSwapViaStargate(srcChain.Rpc, c1, account, soData, srcSwapDataList, stargateData, dstSwapDataList, value)
-		return err
-	})
-	return txHash, err
+func (c *Client) soSwapViaStargate(ctx context.Context, srcChain Chain, soData SoData, srcSwapDataList []SwapData, stargateData StargateData, dstSwapDataList []SwapData, value *big.Int) (string, error) {
+	account, err := c.signer()
+	if err != nil {
+		return "", err
+	}
+	msg, err := newDiamondContract(c.abis, common.HexToAddress(srcChain.SoDiamond)).
+		PackSoSwapViaStargate(account.Address(), soData, srcSwapDataList, stargateData, dstSwapDataList)
+	if err != nil {
+		return "", err
+	}
+	txHash, err := c.sendTx(ctx, srcChain, account, msg, value)
+	return txHash, revertError(err, c.abis.diamond)
 }
 
-func getStargateFee(chain Chain, soData SoData, stargateData StargateData, swapDataList []SwapData) (*big.Int, error) {
-	pool := getConnectPool(chain.Rpc)
+func (c *Client) getStargateFee(ctx context.Context, chain Chain, soData SoData, stargateData StargateData, swapDataList []SwapData) (*big.Int, error) {
+	pool := c.getConnectPool(chain)
 	var result *big.Int
 	var err error
-	err = pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-		result, err = newDiamondContract(common.HexToAddress(chain.SoDiamond)).
-			GetStargateFee(c1, soData, stargateData, swapDataList)
+	err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		result, err = newDiamondContract(c.abis, common.HexToAddress(chain.SoDiamond)).
+			GetStargateFee(ctx, c1, soData, stargateData, swapDataList)
 		return err
 	})
 	return result, err
 }
 
-func approve(chain Chain, tokenAddress string, approveTo string, amount *big.Int) (result string, err error) {
-	pool := getConnectPool(chain.Rpc)
-	pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-		result, err = newErc20Contract(common.HexToAddress(tokenAddress)).Approve(chain.Rpc, c1, account, common.HexToAddress(approveTo), amount)
-		return err
-	})
+func (c *Client) approve(ctx context.Context, chain Chain, tokenAddress string, approveTo string, amount *big.Int) (result string, err error) {
+	account, err := c.signer()
+	if err != nil {
+		return "", err
+	}
+	msg, err := newErc20Contract(c.abis, common.HexToAddress(tokenAddress)).
+		PackApprove(account.Address(), common.HexToAddress(approveTo), amount)
+	if err != nil {
+		return "", err
+	}
+	result, err = c.sendTx(ctx, chain, account, msg, big.NewInt(0))
+	err = revertError(err, c.abis.erc20)
 
 	if err == nil {
-		fmt.Println("===========================================================")
-		fmt.Println("approve to token:")
-		fmt.Printf("token:  %s\n", tokenAddress)
-		fmt.Printf("to:     %s\n", chain.SoDiamond)
-		fmt.Printf("amount: %s\n", amount)
-		fmt.Printf("hash:   %s\n", result)
+		var b strings.Builder
+		fmt.Fprintln(&b, "===========================================================")
+		fmt.Fprintln(&b, "approve to token:")
+		fmt.Fprintf(&b, "token:  %s\n", tokenAddress)
+		fmt.Fprintf(&b, "to:     %s\n", chain.SoDiamond)
+		fmt.Fprintf(&b, "amount: %s\n", amount)
+		fmt.Fprintf(&b, "hash:   %s\n", result)
+		c.logger.Printf("%s", b.String())
 	}
 	return
 }
 
-func waitForTxSuccess(rpcStr string, txHash string) error {
-	pool := getConnectPool(rpcStr)
-	ctx := context.Background()
-	hashObj := common.HexToHash(txHash)
-	isPending := true
-	var err error
-	success := false
-
-	fmt.Println(color.HiYellowString("wait tx %s", txHash))
-	for isPending {
-		time.Sleep(time.Second * 3)
-		pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-			_, isPending, err = c1.TransactionByHash(ctx, hashObj)
-			if err != nil {
-				return err
-			}
-			receipt, err := c1.TransactionReceipt(ctx, hashObj)
-			if err != nil {
-				return err
-			}
-			if receipt.Status == 0 {
-				success = false
-			} else {
-				success = true
-			}
-			return nil
-		})
-	}
-	if success {
-		fmt.Println(color.HiGreenString("tx success %s", txHash))
-		return nil
-	} else {
-		fmt.Println(color.HiRedString("tx failed %s", txHash))
-	}
-	return errors.New("transaction failed:" + txHash)
-}
-
 // estimateUniswapAmount 估算此路径下 uniswap amountOut amountMinOut
-func estimateUniswapAmount(chainInfo Chain, amountIn *big.Int, slippage float32, path []common.Address) (*big.Int, *big.Int, error) {
-	pool := getConnectPool(chainInfo.Rpc)
+func (c *Client) estimateUniswapAmount(ctx context.Context, chainInfo Chain, amountIn *big.Int, slippage float32, path []common.Address) (*big.Int, *big.Int, error) {
+	pool := c.getConnectPool(chainInfo)
 	var err error
 	var amountOut *big.Int
 	var amountMinOut *big.Int
 
 	swapVersion := versionV2
 	quoteAdderss := ""
-	if chainInfo.Swap[0][1] == "ISwapRouter" {
+	if chainInfo.Swap[0][1] == swapTypeUniswapV3 {
 		swapVersion = versionV3
 		quoteAdderss = chainInfo.Swap[0][2]
 	}
 
-	err = pool.Call(func(c1 *ethclient.Client, c2 *rpc.Client) error {
-		amountsOut, err := newUnisapV2Contract(common.HexToAddress(chainInfo.Swap[0][0]), swapVersion, quoteAdderss).
-			GetAmountsOut(c1, amountIn, path)
+	err = pool.Read(ctx, func(c1 *ethclient.Client, c2 *rpc.Client) error {
+		amountsOut, err := newUnisapV2Contract(c.abis, common.HexToAddress(chainInfo.Swap[0][0]), swapVersion, quoteAdderss).
+			GetAmountsOut(ctx, c1, amountIn, path)
 		if err != nil {
 			return err
 		}
@@ -371,63 +256,60 @@ func estimateUniswapAmount(chainInfo Chain, amountIn *big.Int, slippage float32,
 
 // estimateMinAmount 根据滑点预估最终得到的最小 amount
 // 返回值：目标 token 最小 amount，stargate 发给目标链的最小 amount
-func estimateMinAmount(toChainInfo Chain, finalAmount *big.Int, slippage float32, dstPath []common.Address) (*big.Int, *big.Int, error) {
+func (c *Client) estimateMinAmount(ctx context.Context, srcBridgeToken Token, toChainInfo Chain, dstBridgeToken Token, finalAmount *big.Int, slippage float32, dstPath []common.Address) (*big.Int, *big.Int, error) {
 	dstTokenMinAmount := decimal.NewFromBigInt(finalAmount, 0).Mul(decimal.NewFromFloat32(1.0 - slippage)).BigInt()
 	stargateMinOut := big.NewInt(0)
 	var err error
-	pool := getConnectPool(toChainInfo.Rpc)
+	pool := c.getConnectPool(toChainInfo)
 	swapVersion := versionV2
 	quoteAdderss := ""
-	if toChainInfo.Swap[0][1] == "ISwapRouter" {
+	if toChainInfo.Swap[0][1] == swapTypeUniswapV3 {
 		swapVersion = versionV3
 		quoteAdderss = toChainInfo.Swap[0][2]
 	}
 	if len(dstPath) > 0 {
-		err = pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-			amountsIn, err := newUnisapV2Contract(common.HexToAddress(toChainInfo.Swap[0][0]), swapVersion, quoteAdderss).GetAmountsIn(c1, dstTokenMinAmount, dstPath)
+		err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			amountsIn, err := newUnisapV2Contract(c.abis, common.HexToAddress(toChainInfo.Swap[0][0]), swapVersion, quoteAdderss).GetAmountsIn(ctx, c1, dstTokenMinAmount, dstPath)
 			if err != nil {
 				return err
 			}
-			stargateMinOut, err = newDiamondContract(common.HexToAddress(toChainInfo.SoDiamond)).GetAmountBeforeSoFee(c1, amountsIn[0])
+			stargateMinOut, err = newDiamondContract(c.abis, common.HexToAddress(toChainInfo.SoDiamond)).GetAmountBeforeSoFee(ctx, c1, amountsIn[0])
 			return err
 		})
 		if err != nil {
 			return nil, nil, err
 		}
-
-		// bsc-test usdc 精度是 18，对于 stargate 输出金额（在 from 链上使用时），需要改回精度 6
-		if toChainInfo.Name == "bsc-test" {
-			stargateMinOut = changeDecimals(stargateMinOut, 18, 6)
-		}
 	} else {
-		err = pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-			stargateMinOut, err = newDiamondContract(common.HexToAddress(toChainInfo.SoDiamond)).GetAmountBeforeSoFee(c1, dstTokenMinAmount)
+		err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			stargateMinOut, err = newDiamondContract(c.abis, common.HexToAddress(toChainInfo.SoDiamond)).GetAmountBeforeSoFee(ctx, c1, dstTokenMinAmount)
 			return err
 		})
 		if err != nil {
 			return nil, nil, err
 		}
 	}
+	// 两边 stargate token 精度可能不同（如 bsc-test usdc 精度是 18），stargate min amount 在 from 链上使用，需要改回源链精度
+	stargateMinOut = changeDecimals(stargateMinOut, dstBridgeToken.Decimals, srcBridgeToken.Decimals)
 	return dstTokenMinAmount, stargateMinOut, nil
 }
 
-// estimateFinalAmount 预估在没有滑点的情况下，最终能得到的 amount
-func estimateFinalAmount(fromChainInfo Chain, amount *big.Int, srcPath []common.Address, stargateData StargateData, toChainInfo Chain, dstPath []common.Address) (*big.Int, error) {
+// estimateFinalAmount 预估在没有滑点的情况下，最终能得到的 amount，同时返回 so fee
+func (c *Client) estimateFinalAmount(ctx context.Context, fromChainInfo Chain, srcBridgeToken Token, amount *big.Int, srcPath []common.Address, stargateData StargateData, toChainInfo Chain, dstBridgeToken Token, dstPath []common.Address) (*big.Int, *big.Int, error) {
 	// 1. 如果 srcPath 不为空，则先根据 uniswap 得到源链的 amount out
 	stargateInAmount := amount
 	var err error
 	// 1. 如果源链需要 swap，先预估 swap 得到的结果
-	srcPool := getConnectPool(fromChainInfo.Rpc)
+	srcPool := c.getConnectPool(fromChainInfo)
 	if len(srcPath) > 0 {
 		swapVersion := versionV2
 		quoteAdderss := ""
-		if fromChainInfo.Swap[0][1] == "ISwapRouter" {
+		if fromChainInfo.Swap[0][1] == swapTypeUniswapV3 {
 			swapVersion = versionV3
 			quoteAdderss = fromChainInfo.Swap[0][2]
 		}
 		// 源链 uniswap 合约估算 amount out
-		err = srcPool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-			amountsOut, err := newUnisapV2Contract(common.HexToAddress(fromChainInfo.Swap[0][0]), swapVersion, quoteAdderss).GetAmountsOut(c1, amount, srcPath)
+		err = srcPool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			amountsOut, err := newUnisapV2Contract(c.abis, common.HexToAddress(fromChainInfo.Swap[0][0]), swapVersion, quoteAdderss).GetAmountsOut(ctx, c1, amount, srcPath)
 			if err != nil {
 				return err
 			}
@@ -435,21 +317,22 @@ func estimateFinalAmount(fromChainInfo Chain, amount *big.Int, srcPath []common.
 			return nil
 		})
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	// 2. 预估 stargate 跨链得到的结果
 	stargateOutAmount := big.NewInt(0)
-	err = srcPool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
+	soFee := big.NewInt(0)
+	err = srcPool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
 		// 2.1 计算跨链结果
-		diamondContract := newDiamondContract(common.HexToAddress(fromChainInfo.SoDiamond))
-		stargateOutAmount, err = diamondContract.EstimateStargateFinalAmount(c1, stargateData, stargateInAmount)
+		diamondContract := newDiamondContract(c.abis, common.HexToAddress(fromChainInfo.SoDiamond))
+		stargateOutAmount, err = diamondContract.EstimateStargateFinalAmount(ctx, c1, stargateData, stargateInAmount)
 		if err != nil {
 			return err
 		}
 		// 2.2 计算 so fee
-		soFee, err := diamondContract.GetSoFee(c1, stargateOutAmount)
+		soFee, err = diamondContract.GetSoFee(ctx, c1, stargateOutAmount)
 		if err != nil {
 			return err
 		}
@@ -457,28 +340,26 @@ func estimateFinalAmount(fromChainInfo Chain, amount *big.Int, srcPath []common.
 		return err
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	// 两边 stargate token 精度可能不同，如 bsc-test usdt 精度是 18
+	stargateOutAmount = changeDecimals(stargateOutAmount, srcBridgeToken.Decimals, dstBridgeToken.Decimals)
 	if len(dstPath) == 0 {
-		return stargateOutAmount, nil
+		return stargateOutAmount, soFee, nil
 	}
 
 	// 3. 如果目标链需要 swap，则预估目标链 swap 结果
 	dstAmountOut := big.NewInt(0)
-	dstPool := getConnectPool(toChainInfo.Rpc)
-	err = dstPool.Call(func(c1 *ethclient.Client, c2 *rpc.Client) error {
-		// bsc-test net, usdt 精度是 18
-		if toChainInfo.Name == "bsc-test" {
-			stargateOutAmount = changeDecimals(stargateOutAmount, 6, 18)
-		}
+	dstPool := c.getConnectPool(toChainInfo)
+	err = dstPool.Read(ctx, func(c1 *ethclient.Client, c2 *rpc.Client) error {
 		swapVersion := versionV2
 		quoteAdderss := ""
-		if toChainInfo.Swap[0][1] == "ISwapRouter" {
+		if toChainInfo.Swap[0][1] == swapTypeUniswapV3 {
 			swapVersion = versionV3
 			quoteAdderss = toChainInfo.Swap[0][2]
 		}
-		dstAmountsOut, err := newUnisapV2Contract(common.HexToAddress(toChainInfo.Swap[0][0]), swapVersion, quoteAdderss).
-			GetAmountsOut(c1, stargateOutAmount, dstPath)
+		dstAmountsOut, err := newUnisapV2Contract(c.abis, common.HexToAddress(toChainInfo.Swap[0][0]), swapVersion, quoteAdderss).
+			GetAmountsOut(ctx, c1, stargateOutAmount, dstPath)
 		if err != nil {
 			return err
 		}
@@ -486,56 +367,44 @@ func estimateFinalAmount(fromChainInfo Chain, amount *big.Int, srcPath []common.
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return dstAmountOut, nil
+	return dstAmountOut, soFee, nil
 }
 
 // estimateForGas 预估目标链的 gas，此为手续费的一项
-func estimateForGas(toChainInfo Chain, soData SoData, toChainSwapData []SwapData) (uint64, error) {
+func (c *Client) estimateForGas(ctx context.Context, toChainInfo Chain, dstBridgeToken Token, soData SoData, toChainSwapData []SwapData) (uint64, error) {
 	var gasRes uint64
 	soDiamond := common.HexToAddress(toChainInfo.SoDiamond)
-	stargatePoolId := big.NewInt(int64(toChainInfo.StargetaPoolId))
-	pool := getConnectPool(toChainInfo.Rpc)
-	pool.Call(func(c1 *ethclient.Client, _ *rpc.Client) error {
-		gas, err := newDiamondContract(soDiamond).SgReceiveForGas(c1, soData, stargatePoolId, toChainSwapData)
+	stargatePoolId := big.NewInt(int64(dstBridgeToken.StargatePoolId))
+	pool := c.getConnectPool(toChainInfo)
+	err := pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		gas, err := newDiamondContract(c.abis, soDiamond).SgReceiveForGas(ctx, c1, soData, stargatePoolId, toChainSwapData)
 		if err != nil {
 			return err
 		}
 		gasRes = gas
 		return nil
 	})
+	if err != nil {
+		return 0, revertError(err, c.abis.diamond)
+	}
 	return gasRes, nil
 }
 
-func getChainInfo(chain string) (Chain, error) {
-	switch chain {
-	case "rinkeby":
-		return config.Networks.Rinkeby, nil
-	case "polygon-test":
-		return config.Networks.PolygonTest, nil
-	case "avax-test":
-		return config.Networks.AvaxTest, nil
-	case "optimism-test":
-		return config.Networks.OptimismTest, nil
-	default:
-		return Chain{}, errUnsupportChain
-	}
+func (c *Client) getChainInfo(chain string) (Chain, error) {
+	return c.config.Networks.Get(chain)
 }
 
-func getChainAndToken(chain, token string) (Chain, string, *big.Int, error) {
-	chainInfo, err := getChainInfo(chain)
+func (c *Client) getChainAndToken(ctx context.Context, chain, token string) (Chain, Token, error) {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return chainInfo, Token{}, err
+	}
+	tokenInfo, err := chainInfo.Token(token)
 	if err != nil {
-		return chainInfo, "", big.NewInt(0), err
-	}
-	switch token {
-	case "usdc":
-		return chainInfo, chainInfo.Usdc, usdcAmount, nil
-	case "eth":
-		return chainInfo, zeroAddress, ethAmount, nil
-	case "weth":
-		return chainInfo, chainInfo.Weth, ethAmount, nil
-	default:
-		return chainInfo, "", ethAmount, errUnsupportToken
+		return chainInfo, tokenInfo, err
 	}
+	tokenInfo, err = c.resolveToken(ctx, chainInfo, tokenInfo)
+	return chainInfo, tokenInfo, err
 }
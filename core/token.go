@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	tokenUsdc = "usdc"
+	tokenEth  = "eth"
+	tokenWeth = "weth"
+
+	nativeDecimals = 18
+)
+
+// initTokens 规范化 token 注册表，并根据 usdc、weth 字段补全默认 token
+func (c *Chain) initTokens() {
+	tokens := make(map[string]Token, len(c.Tokens)+3)
+	for key, token := range c.Tokens {
+		if token.Symbol == "" {
+			token.Symbol = strings.ToUpper(key)
+		}
+		if token.Native {
+			if token.Address == "" {
+				token.Address = zeroAddress
+			}
+			if token.Decimals == 0 {
+				token.Decimals = nativeDecimals
+			}
+		}
+		tokens[strings.ToLower(key)] = token
+	}
+	if _, ok := tokens[tokenUsdc]; !ok && c.Usdc != "" {
+		tokens[tokenUsdc] = Token{Symbol: "USDC", Address: c.Usdc, StargatePoolId: c.StargetaPoolId}
+	}
+	// eth 始终代表链原生币，avax 等链也可以用 eth 指代
+	if _, ok := tokens[tokenEth]; !ok {
+		tokens[tokenEth] = Token{Symbol: "ETH", Address: zeroAddress, Decimals: nativeDecimals, Native: true}
+	}
+	if _, ok := tokens[tokenWeth]; !ok && c.Weth != "" {
+		tokens[tokenWeth] = Token{Symbol: "WETH", Address: c.Weth, Decimals: nativeDecimals}
+	}
+	c.Tokens = tokens
+}
+
+// Token 根据 symbol 查找 token，也可以直接传 erc20 合约地址
+func (c Chain) Token(symbol string) (Token, error) {
+	if token, ok := c.Tokens[strings.ToLower(symbol)]; ok {
+		return token, nil
+	}
+	if common.IsHexAddress(symbol) {
+		for _, token := range c.Tokens {
+			if sameAddress(token.Address, symbol) {
+				return token, nil
+			}
+		}
+		return Token{Symbol: symbol, Address: symbol}, nil
+	}
+	return Token{}, fmt.Errorf("%w: %s on %s", errUnsupportToken, symbol, c.Name)
+}
+
+// bridgeToken 返回跨链时通过 stargate 发送或接收的 token
+// token 本身配置了 stargate pool 则直接跨链，否则需要在链上 swap 成 usdc 再跨链
+func (c Chain) bridgeToken(token Token) Token {
+	if token.StargatePoolId > 0 {
+		return token
+	}
+	bridge, err := c.Token(c.Usdc)
+	if err != nil || bridge.Native {
+		bridge = Token{Symbol: "USDC", Address: c.Usdc}
+	}
+	if bridge.StargatePoolId == 0 {
+		bridge.StargatePoolId = c.StargetaPoolId
+	}
+	return bridge
+}
+
+// resolveToken 补全 token 的 decimals，未配置时从链上读取
+func (c *Client) resolveToken(ctx context.Context, chain Chain, token Token) (Token, error) {
+	if token.Decimals > 0 {
+		return token, nil
+	}
+	if token.Native {
+		token.Decimals = nativeDecimals
+		return token, nil
+	}
+
+	key := chain.Name + "/" + strings.ToLower(token.Address)
+	c.tokenDecimalsLock.Lock()
+	decimals, ok := c.tokenDecimals[key]
+	c.tokenDecimalsLock.Unlock()
+	if ok {
+		token.Decimals = decimals
+		return token, nil
+	}
+
+	var err error
+	pool := c.getConnectPool(chain)
+	err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		var res uint8
+		res, err = newErc20Contract(c.abis, common.HexToAddress(token.Address)).Decimals(ctx, c1)
+		decimals = int32(res)
+		return err
+	})
+	if err != nil {
+		return token, fmt.Errorf("read decimals of %s on %s: %w", token.Symbol, chain.Name, err)
+	}
+	c.tokenDecimalsLock.Lock()
+	c.tokenDecimals[key] = decimals
+	c.tokenDecimalsLock.Unlock()
+	token.Decimals = decimals
+	return token, nil
+}
+
+// Amount 用户指定的 swap 数量
+// Raw 为 false 时 Value 是可读数量（如 "12.5"），按 token 精度转换；Raw 为 true 时 Value 是链上最小单位（wei）
+type Amount struct {
+	Value string
+	Raw   bool
+}
+
+// toBigInt 转换为链上精度的数量，Value 为空时使用 token 配置的默认数量
+func (a Amount) toBigInt(token Token) (*big.Int, error) {
+	if a.Value == "" {
+		return token.defaultAmount()
+	}
+	if !a.Raw {
+		return parseAmount(a.Value, token.Decimals)
+	}
+	amount, ok := big.NewInt(0).SetString(a.Value, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid raw amount %s", a.Value)
+	}
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("amount %s must be positive", a.Value)
+	}
+	return amount, nil
+}
+
+// defaultAmount 返回 token 配置的默认 swap 数量
+func (t Token) defaultAmount() (*big.Int, error) {
+	if t.Amount == "" {
+		return nil, fmt.Errorf("no amount configured for token %s", t.Symbol)
+	}
+	return parseAmount(t.Amount, t.Decimals)
+}
+
+func sameAddress(a, b string) bool {
+	return common.HexToAddress(a) == common.HexToAddress(b)
+}
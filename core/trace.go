@@ -0,0 +1,319 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// defaultTraceLookback 按 TransactionId 查找源链交易时默认向前查找的时间范围
+const defaultTraceLookback = 7 * 24 * time.Hour
+
+// TimelineEvent swap 追踪时间线上的一个节点
+type TimelineEvent struct {
+	Time   time.Time
+	Chain  string
+	Event  string
+	Detail string
+}
+
+// SwapTrace 根据源链交易 hash 还原的 swap 参数及执行过程
+type SwapTrace struct {
+	FromChain string
+	ToChain   string
+	TxHash    common.Hash
+	From      common.Address
+	Method    string
+
+	SoData       SoData
+	SrcSwapData  []SwapData
+	StargateData *StargateData // 单链 swap 为空
+	DstSwapData  []SwapData
+
+	Source   *TxResult
+	Started  *TransferStarted
+	Transfer *Transfer // 目标链还未到账时为空
+
+	Timeline []TimelineEvent
+}
+
+func (t *SwapTrace) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "swap trace:")
+	fmt.Fprintf(&b, "TxHash:  %s\n", t.TxHash.Hex())
+	fmt.Fprintf(&b, "Chain:   %s -> %s\n", t.FromChain, t.ToChain)
+	fmt.Fprintf(&b, "From:    %s\n", t.From.Hex())
+	fmt.Fprintf(&b, "Method:  %s\n", t.Method)
+	b.WriteString(t.SoData.String())
+	for i := range t.SrcSwapData {
+		b.WriteString(t.SrcSwapData[i].String())
+	}
+	if t.StargateData != nil {
+		b.WriteString(t.StargateData.String())
+	}
+	for i := range t.DstSwapData {
+		b.WriteString(t.DstSwapData[i].String())
+	}
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "timeline:")
+	for _, e := range t.Timeline {
+		fmt.Fprintf(&b, "%s  %-14s %-22s %s\n", e.Time.Format(time.RFC3339), e.Chain, e.Event, e.Detail)
+	}
+	return b.String()
+}
+
+func (t *SwapTrace) add(at time.Time, chain, event, detail string) {
+	t.Timeline = append(t.Timeline, TimelineEvent{Time: at, Chain: chain, Event: event, Detail: detail})
+}
+
+// soSwapInput soSwapViaStargate / swapTokensGeneric 的参数，字段名与 abi 参数名对应
+type soSwapInput struct {
+	SoData       SoData
+	SwapData     []SwapData
+	SwapDataSrc  []SwapData
+	StargateData StargateData
+	SwapDataDst  []SwapData
+}
+
+// TraceSwap 根据源链交易 hash 解析 swap 参数，并在目标链查找到账事件，返回完整的时间线
+// fromChain 为空时在所有配置的链上查找交易
+func (c *Client) TraceSwap(ctx context.Context, fromChain string, txHash string) (*SwapTrace, error) {
+	hash := common.HexToHash(txHash)
+	fromChainInfo, tx, err := c.findTx(ctx, fromChain, hash)
+	if err != nil {
+		return nil, err
+	}
+	trace := &SwapTrace{
+		FromChain: fromChainInfo.Name,
+		ToChain:   fromChainInfo.Name,
+		TxHash:    hash,
+	}
+	if trace.From, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
+		return nil, err
+	}
+	if tx.To() == nil || *tx.To() != common.HexToAddress(fromChainInfo.SoDiamond) {
+		return nil, fmt.Errorf("tx %s is not sent to SoDiamond %s", txHash, fromChainInfo.SoDiamond)
+	}
+
+	// 1. 解析 calldata
+	var input soSwapInput
+	method, err := unpackInput(&input, c.abis.diamond, tx.Data())
+	if err != nil {
+		return nil, fmt.Errorf("decode input: %w", err)
+	}
+	trace.Method = method.Name
+	trace.SoData = input.SoData
+	switch method.Name {
+	case methodSoSwapViaStargate:
+		trace.SrcSwapData = input.SwapDataSrc
+		trace.StargateData = &input.StargateData
+		trace.DstSwapData = input.SwapDataDst
+	case methodSwapTokensGeneric:
+		trace.SrcSwapData = input.SwapData
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportMethod, method.Name)
+	}
+
+	// 2. 源链交易结果
+	// 源链交易未在等待时间内上链时返回已解析的参数
+	trace.Source, err = c.watchTx(ctx, fromChainInfo, hash, c.watch)
+	if waitExpired(err) {
+		trace.add(time.Now(), fromChainInfo.Name, "pending", "nonce "+fmt.Sprint(tx.Nonce())+" not mined yet")
+		return trace, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	source := trace.Source
+	if source.Block == nil {
+		trace.add(time.Now(), fromChainInfo.Name, "tx "+source.Status.String(), "nonce "+fmt.Sprint(tx.Nonce()))
+		return trace, nil
+	}
+	srcTime := time.Unix(int64(source.Block.Time), 0)
+	trace.add(srcTime, fromChainInfo.Name, "tx "+source.Status.String(),
+		fmt.Sprintf("block %d gas used %d fee %s", source.Receipt.BlockNumber, source.GasUsed, formatAmount(source.Fee(), nativeDecimals)))
+	if source.Status != TxSuccess || trace.StargateData == nil {
+		return trace, nil
+	}
+
+	// 3. 目标链
+	toChainInfo, err := c.destinationChain(trace.SoData, *trace.StargateData)
+	if err != nil {
+		return nil, err
+	}
+	trace.ToChain = toChainInfo.Name
+	trace.Started, err = c.decodeTransferStarted(fromChainInfo, source.Receipt)
+	if err != nil {
+		return nil, err
+	}
+	trace.Started.Time = srcTime
+	trace.add(srcTime, fromChainInfo.Name, eventSoTransferStarted,
+		fmt.Sprintf("bridge %s transactionId %s", trace.Started.Bridge, trace.Started.TransactionId.Hex()))
+
+	trace.Transfer, err = c.waitTransferDelivered(ctx, fromChainInfo, toChainInfo, trace.Started)
+	if waitExpired(err) {
+		trace.add(time.Now(), toChainInfo.Name, "pending", "no SoTransferCompleted/SoTransferFailed yet")
+		return trace, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	transfer := trace.Transfer
+	if transfer.Status == TransferCompleted {
+		trace.add(transfer.DstTime, toChainInfo.Name, eventSoTransferCompleted,
+			fmt.Sprintf("tx %s received %s of %s latency %s", transfer.DstTxHash.Hex(), transfer.ReceiveAmount, transfer.ReceivingAssetId.Hex(), transfer.Latency))
+	} else {
+		trace.add(transfer.DstTime, toChainInfo.Name, eventSoTransferFailed,
+			fmt.Sprintf("tx %s reason %q latency %s", transfer.DstTxHash.Hex(), transfer.RevertReason, transfer.Latency))
+	}
+	return trace, nil
+}
+
+// waitExpired 等待超时或 ctx 被取消
+func waitExpired(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// TraceSwapByTransactionId 根据 SoData 的 TransactionId 在源链查找 SoTransferStarted 事件，然后按其所在交易追踪 swap
+// fromChain 为空时在所有配置的链上查找；只查找最近 lookback 时间内的块，为 0 时查找最近 7 天
+// 只有跨链 swap 会触发 SoTransferStarted，单链 swap 需要使用交易 hash 追踪
+func (c *Client) TraceSwapByTransactionId(ctx context.Context, fromChain string, transactionId string, lookback time.Duration) (*SwapTrace, error) {
+	id, err := hexutil.Decode(transactionId)
+	if err != nil || len(id) != common.HashLength {
+		return nil, fmt.Errorf("invalid transaction id %s", transactionId)
+	}
+	if lookback == 0 {
+		lookback = defaultTraceLookback
+	}
+	chains, err := c.traceChains(fromChain)
+	if err != nil {
+		return nil, err
+	}
+	for _, chainInfo := range chains {
+		txHash, err := c.findTransferStarted(ctx, chainInfo, common.BytesToHash(id), time.Now().Add(-lookback))
+		if err == nil {
+			return c.TraceSwap(ctx, chainInfo.Name, txHash.Hex())
+		}
+		if !errors.Is(err, errNoTransferStarted) {
+			if fromChain != "" {
+				return nil, err
+			}
+			c.logger.Printf("find transaction id on %s: %s\n", chainInfo.Name, err)
+		}
+	}
+	return nil, fmt.Errorf("transaction id %s not found", transactionId)
+}
+
+// findTransferStarted 从最新块向前查找 since 之后 chain 上 SoDiamond 发出的 TransactionId 为 id 的 SoTransferStarted，返回其交易 hash
+func (c *Client) findTransferStarted(ctx context.Context, chain Chain, id common.Hash, since time.Time) (common.Hash, error) {
+	fromBlock, err := c.blockAtTime(ctx, chain, since)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	pool := c.getConnectPool(chain)
+	var latest uint64
+	err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		latest, err = c1.BlockNumber(ctx)
+		return err
+	})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(chain.SoDiamond)},
+		Topics:    [][]common.Hash{{c.abis.diamond.Events[eventSoTransferStarted].ID}, {id}},
+	}
+	// 用户一般追踪最近的 swap，从最新块开始向前查找
+	for to := latest; to >= fromBlock; {
+		from := fromBlock
+		if to-fromBlock >= maxLogBlockRange {
+			from = to - maxLogBlockRange + 1
+		}
+		q := query
+		q.FromBlock = new(big.Int).SetUint64(from)
+		q.ToBlock = new(big.Int).SetUint64(to)
+		var logs []types.Log
+		err = pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			logs, err = c1.FilterLogs(ctx, q)
+			return err
+		})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		for _, l := range logs {
+			if !l.Removed {
+				return l.TxHash, nil
+			}
+		}
+		if from == 0 {
+			break
+		}
+		to = from - 1
+	}
+	return common.Hash{}, errNoTransferStarted
+}
+
+// traceChains 返回要查找的链，chain 为空时返回所有配置的链
+func (c *Client) traceChains(chain string) ([]Chain, error) {
+	if chain != "" {
+		chainInfo, err := c.getChainInfo(chain)
+		if err != nil {
+			return nil, err
+		}
+		return []Chain{chainInfo}, nil
+	}
+	var chains []Chain
+	for _, name := range c.config.Networks.Names() {
+		chains = append(chains, c.config.Networks.Chains[name])
+	}
+	return chains, nil
+}
+
+// findTx 在 chain 上查找交易，chain 为空时依次查找所有配置的链
+func (c *Client) findTx(ctx context.Context, chain string, hash common.Hash) (Chain, *types.Transaction, error) {
+	chains, err := c.traceChains(chain)
+	if err != nil {
+		return Chain{}, nil, err
+	}
+	for _, chainInfo := range chains {
+		var tx *types.Transaction
+		err := c.getConnectPool(chainInfo).Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			var err error
+			tx, _, err = c1.TransactionByHash(ctx, hash)
+			return err
+		})
+		if err == nil {
+			return chainInfo, tx, nil
+		}
+		if ctx.Err() != nil {
+			return Chain{}, nil, ctx.Err()
+		}
+		if !errors.Is(err, ethereum.NotFound) && chain != "" {
+			return Chain{}, nil, err
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			c.logger.Printf("find tx on %s: %s\n", chainInfo.Name, err)
+		}
+	}
+	return Chain{}, nil, fmt.Errorf("tx %s not found", hash.Hex())
+}
+
+// destinationChain 根据 SoData 的 evm chain id 查找目标链，找不到时使用 stargate chain id
+func (c *Client) destinationChain(soData SoData, stargateData StargateData) (Chain, error) {
+	chain, err := c.config.Networks.ByChainId(int(soData.DestinationChainId.Int64()))
+	if err == nil {
+		return chain, nil
+	}
+	return c.config.Networks.ByStargateChainId(int(stargateData.DstStargateChainId))
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"so-omnichain-example/signer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakePendingNode 模拟节点：交易一直在交易池中，没有回执
+type fakePendingNode struct {
+	tx *types.Transaction
+}
+
+func (n *fakePendingNode) GetTransactionByHash(hash common.Hash) (*types.Transaction, error) {
+	if hash != n.tx.Hash() {
+		return nil, nil
+	}
+	return n.tx, nil
+}
+
+func (n *fakePendingNode) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	return nil, nil
+}
+
+func (n *fakePendingNode) GetTransactionCount(account common.Address, block string) (hexutil.Uint64, error) {
+	return hexutil.Uint64(n.tx.Nonce()), nil
+}
+
+// testChain 通过 Validate 的最小链配置
+func testChain(name string, chainId, stargateChainId int, rpcUrl string, diamond common.Address) Chain {
+	address := "0x0000000000000000000000000000000000000001"
+	return Chain{
+		Name:            name,
+		ChainId:         chainId,
+		Rpc:             rpcUrl,
+		StargateRouter:  address,
+		SoDiamond:       diamond.Hex(),
+		StargateChainId: stargateChainId,
+		StargetaPoolId:  1,
+		Usdc:            address,
+		Weth:            address,
+		Swap:            [][]string{{address, swapTypeUniswapV2}},
+	}
+}
+
+func testClient(t *testing.T, chains []Chain, watch WatchOptions) *Client {
+	t.Helper()
+	networks := Networks{Chains: make(map[string]Chain)}
+	for _, chain := range chains {
+		networks.Chains[chain.Name] = chain
+	}
+	client, err := NewClient(Options{Config: Config{Networks: networks}, Logger: testLogger{t}, Watch: watch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestTraceSwapPendingSource(t *testing.T) {
+	abis := testAbis(t)
+	diamond := common.HexToAddress("0x7E88c5E7134E4589F6316636CA8Fe8Cc9f8ED505")
+	soData := SoData{
+		TransactionId:      [32]byte{1, 2, 3},
+		Receiver:           common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"),
+		SourceChainId:      big.NewInt(5),
+		DestinationChainId: big.NewInt(5),
+		Amount:             big.NewInt(1e16),
+	}
+	swap := []SwapData{{FromAmount: big.NewInt(1e16), CallData: []byte{0xde, 0xad, 0xbe, 0xef}}}
+	data, err := abis.diamond.Pack(methodSwapTokensGeneric, soData, swap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := account.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(5),
+		Nonce:     7,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(1e11),
+		Gas:       300000,
+		To:        &diamond,
+		Data:      data,
+	}), big.NewInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := rpc.NewServer()
+	if err = server.RegisterName("eth", &fakePendingNode{tx: tx}); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	node := httptest.NewServer(server)
+	defer node.Close()
+
+	client := testClient(t, []Chain{testChain("goerli", 5, 10021, node.URL, diamond)},
+		WatchOptions{Timeout: 200 * time.Millisecond, PollInterval: 20 * time.Millisecond})
+	defer client.Shutdown(context.Background())
+
+	// 源链交易未上链时返回已解析的参数及 pending 节点
+	trace, err := client.TraceSwap(context.Background(), "goerli", tx.Hash().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Method != methodSwapTokensGeneric || trace.SoData.TransactionId != soData.TransactionId || len(trace.SrcSwapData) != 1 {
+		t.Fatalf("calldata not decoded: %s %+v", trace.Method, trace.SoData)
+	}
+	if trace.From != account.Address() || trace.Source != nil {
+		t.Fatalf("from %s source %+v", trace.From.Hex(), trace.Source)
+	}
+	if len(trace.Timeline) != 1 || trace.Timeline[0].Event != "pending" || trace.Timeline[0].Chain != "goerli" {
+		t.Fatalf("timeline = %+v, want a single pending entry", trace.Timeline)
+	}
+	if !strings.Contains(trace.String(), "pending") {
+		t.Fatalf("pending entry missing from output:\n%s", trace)
+	}
+
+	// 等待源链交易时 ctx 被取消同样返回部分结果
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if trace, err = client.TraceSwap(ctx, "goerli", tx.Hash().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if len(trace.Timeline) != 1 || trace.Timeline[0].Event != "pending" {
+		t.Fatalf("timeline = %+v, want a single pending entry", trace.Timeline)
+	}
+}
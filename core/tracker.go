@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	eventSoTransferStarted   = "SoTransferStarted"
+	eventSoTransferCompleted = "SoTransferCompleted"
+	eventSoTransferFailed    = "SoTransferFailed"
+
+	// defaultDeliveryTimeout 等待目标链到账的默认超时时间
+	defaultDeliveryTimeout = 30 * time.Minute
+)
+
+var errNoTransferStarted = errors.New("no SoTransferStarted event in receipt")
+
+// TransferStatus 跨链交易在目标链上的结果
+type TransferStatus int
+
+const (
+	TransferCompleted TransferStatus = iota // 目标链 SoTransferCompleted
+	TransferFailed                          // 目标链 SoTransferFailed
+)
+
+func (s TransferStatus) String() string {
+	switch s {
+	case TransferCompleted:
+		return "completed"
+	case TransferFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("TransferStatus(%d)", int(s))
+}
+
+// TransferStarted 源链 SoDiamond 的 SoTransferStarted 事件
+type TransferStarted struct {
+	TransactionId      common.Hash
+	Bridge             string
+	HasSourceSwap      bool
+	HasDestinationSwap bool
+	SoData             SoData
+
+	TxHash      common.Hash
+	BlockNumber uint64
+	Time        time.Time // 源链交易所在块的时间
+}
+
+// Transfer 跨链交易从源链发出到目标链到账的完整结果
+type Transfer struct {
+	FromChain string
+	ToChain   string
+	Started   TransferStarted
+	Status    TransferStatus
+
+	DstTxHash      common.Hash
+	DstBlockNumber uint64
+	DstTime        time.Time
+
+	// SoTransferCompleted
+	ReceivingAssetId common.Address
+	Receiver         common.Address
+	ReceiveAmount    *big.Int
+
+	// SoTransferFailed
+	RevertReason string
+	OtherReason  []byte
+
+	Latency time.Duration // 源链交易所在块到目标链交易所在块的时间
+}
+
+func (t *Transfer) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "===========================================================")
+	fmt.Fprintln(&b, "cross chain transfer:")
+	fmt.Fprintf(&b, "TransactionId:  %s\n", t.Started.TransactionId.Hex())
+	fmt.Fprintf(&b, "Bridge:         %s\n", t.Started.Bridge)
+	fmt.Fprintf(&b, "Source:         %s %s block %d\n", t.FromChain, t.Started.TxHash.Hex(), t.Started.BlockNumber)
+	fmt.Fprintf(&b, "Destination:    %s %s block %d\n", t.ToChain, t.DstTxHash.Hex(), t.DstBlockNumber)
+	fmt.Fprintf(&b, "Status:         %s\n", t.Status)
+	if t.Status == TransferCompleted {
+		fmt.Fprintf(&b, "Receiver:       %s\n", t.Receiver.Hex())
+		fmt.Fprintf(&b, "ReceivingAsset: %s\n", t.ReceivingAssetId.Hex())
+		fmt.Fprintf(&b, "ReceiveAmount:  %s\n", t.ReceiveAmount)
+	} else {
+		fmt.Fprintf(&b, "RevertReason:   %s\n", t.RevertReason)
+		fmt.Fprintf(&b, "OtherReason:    0x%x\n", t.OtherReason)
+	}
+	fmt.Fprintf(&b, "Latency:        %s\n", t.Latency)
+	return b.String()
+}
+
+// TrackTransfer 等待源链交易上链，然后在目标链等待同一 TransactionId 的 SoTransferCompleted 或 SoTransferFailed
+func (c *Client) TrackTransfer(ctx context.Context, fromChain string, txHash string) (*Transfer, error) {
+	fromChainInfo, err := c.getChainInfo(fromChain)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.watchTx(ctx, fromChainInfo, common.HexToHash(txHash), c.watch)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != TxSuccess {
+		return nil, fmt.Errorf("transaction %s: %s", result.Status, txHash)
+	}
+	return c.trackDelivery(ctx, fromChainInfo, result)
+}
+
+// trackDelivery 根据源链回执中的 SoTransferStarted，在目标链查找对应的到账事件
+func (c *Client) trackDelivery(ctx context.Context, fromChain Chain, src *TxResult) (*Transfer, error) {
+	started, err := c.decodeTransferStarted(fromChain, src.Receipt)
+	if err != nil {
+		return nil, err
+	}
+	started.Time = time.Unix(int64(src.Block.Time), 0)
+	toChain, err := c.config.Networks.ByChainId(int(started.SoData.DestinationChainId.Int64()))
+	if err != nil {
+		return nil, fmt.Errorf("destination chain %s: %w", started.SoData.DestinationChainId, err)
+	}
+	return c.waitTransferDelivered(ctx, fromChain, toChain, started)
+}
+
+// waitTransferDelivered 从源链交易时间对应的目标链块开始查找到账事件
+func (c *Client) waitTransferDelivered(ctx context.Context, fromChain, toChain Chain, started *TransferStarted) (*Transfer, error) {
+	timeout := c.watch.DeliveryTimeout
+	if timeout == 0 {
+		timeout = defaultDeliveryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fromBlock, err := c.blockAtTime(ctx, toChain, started.Time)
+	if err != nil {
+		return nil, err
+	}
+	completed := c.abis.diamond.Events[eventSoTransferCompleted]
+	failed := c.abis.diamond.Events[eventSoTransferFailed]
+	topics := [][]common.Hash{{completed.ID, failed.ID}, {started.TransactionId}}
+
+	c.logger.Printf("wait %s transfer %s on %s from block %d\n", started.Bridge, started.TransactionId.Hex(), toChain.Name, fromBlock)
+	var transfer *Transfer
+	err = c.watchDiamondLogs(ctx, toChain, fromBlock, topics, c.watch.withDefaults().PollInterval, func(l types.Log) (bool, error) {
+		transfer, err = c.decodeTransferResult(ctx, toChain, l)
+		return transfer != nil, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("wait transfer %s on %s: %w", started.TransactionId.Hex(), toChain.Name, err)
+	}
+	transfer.FromChain = fromChain.Name
+	transfer.ToChain = toChain.Name
+	transfer.Started = *started
+	transfer.Latency = transfer.DstTime.Sub(started.Time)
+	return transfer, nil
+}
+
+// decodeTransferStarted 从源链回执中解析 SoDiamond 的 SoTransferStarted 事件
+func (c *Client) decodeTransferStarted(chain Chain, receipt *types.Receipt) (*TransferStarted, error) {
+	event := c.abis.diamond.Events[eventSoTransferStarted]
+	soDiamond := common.HexToAddress(chain.SoDiamond)
+	for _, l := range receipt.Logs {
+		if l.Address != soDiamond || len(l.Topics) < 2 || l.Topics[0] != event.ID {
+			continue
+		}
+		started := &TransferStarted{
+			TransactionId: l.Topics[1],
+			TxHash:        l.TxHash,
+			BlockNumber:   l.BlockNumber,
+		}
+		if err := c.abis.diamond.UnpackIntoInterface(started, eventSoTransferStarted, l.Data); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", eventSoTransferStarted, err)
+		}
+		return started, nil
+	}
+	return nil, errNoTransferStarted
+}
+
+// decodeTransferResult 解析目标链的 SoTransferCompleted 或 SoTransferFailed 事件
+func (c *Client) decodeTransferResult(ctx context.Context, chain Chain, l types.Log) (*Transfer, error) {
+	diamond := c.abis.diamond
+	transfer := &Transfer{
+		DstTxHash:      l.TxHash,
+		DstBlockNumber: l.BlockNumber,
+	}
+	switch l.Topics[0] {
+	case diamond.Events[eventSoTransferCompleted].ID:
+		var event struct {
+			ReceivingAssetId common.Address
+			Receiver         common.Address
+			ReceiveAmount    *big.Int
+			Timestamp        *big.Int
+			SoData           SoData
+		}
+		if err := diamond.UnpackIntoInterface(&event, eventSoTransferCompleted, l.Data); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", eventSoTransferCompleted, err)
+		}
+		transfer.Status = TransferCompleted
+		transfer.ReceivingAssetId = event.ReceivingAssetId
+		transfer.Receiver = event.Receiver
+		transfer.ReceiveAmount = event.ReceiveAmount
+	case diamond.Events[eventSoTransferFailed].ID:
+		var event struct {
+			RevertReason string
+			OtherReason  []byte
+			SoData       SoData
+		}
+		if err := diamond.UnpackIntoInterface(&event, eventSoTransferFailed, l.Data); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", eventSoTransferFailed, err)
+		}
+		transfer.Status = TransferFailed
+		transfer.RevertReason = event.RevertReason
+		transfer.OtherReason = event.OtherReason
+	default:
+		return nil, nil
+	}
+
+	err := c.getConnectPool(chain).Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		header, err := c1.HeaderByHash(ctx, l.BlockHash)
+		if err != nil {
+			return err
+		}
+		transfer.DstTime = time.Unix(int64(header.Time), 0)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// headerSource 按块高查询块头，number 为 nil 时查询最新块
+type headerSource func(ctx context.Context, number *big.Int) (*types.Header, error)
+
+// blockAtTime 二分查找 chain 上时间不晚于 t 的最后一个块
+func (c *Client) blockAtTime(ctx context.Context, chain Chain, t time.Time) (uint64, error) {
+	var result uint64
+	err := c.getConnectPool(chain).Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+		var err error
+		result, err = searchBlockAtTime(ctx, c1.HeaderByNumber, t)
+		return err
+	})
+	return result, err
+}
+
+// searchBlockAtTime 在 [0, 最新块] 中二分查找时间不晚于 t 的最后一个块，所有块都晚于 t 时返回 0
+func searchBlockAtTime(ctx context.Context, headerByNumber headerSource, t time.Time) (uint64, error) {
+	latest, err := headerByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	target := uint64(t.Unix())
+	lo, hi := uint64(0), latest.Number.Uint64()
+	if latest.Time <= target {
+		return hi, nil
+	}
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		header, err := headerByNumber(ctx, new(big.Int).SetUint64(mid))
+		if err != nil {
+			return 0, err
+		}
+		if header.Time <= target {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBlockTime 测试链第 n 个块的时间，块间隔 12 秒，从 10 开始每块 3 秒，模拟出块间隔变化
+func testBlockTime(n uint64) uint64 {
+	const base = 1660000000
+	if n <= 10 {
+		return base + 12*n
+	}
+	return base + 120 + 3*(n-10)
+}
+
+func testHeader(n uint64) *types.Header {
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(n),
+		Time:       testBlockTime(n),
+		Difficulty: big.NewInt(0),
+		Extra:      []byte{},
+	}
+}
+
+// testHeaders 按块高返回测试链块头，latest 为最新块，调用次数记录在 calls
+func testHeaders(latest uint64, calls *int) headerSource {
+	return func(ctx context.Context, number *big.Int) (*types.Header, error) {
+		*calls++
+		if number == nil {
+			return testHeader(latest), nil
+		}
+		if number.Uint64() > latest {
+			return nil, errors.New("block not found")
+		}
+		return testHeader(number.Uint64()), nil
+	}
+}
+
+func TestSearchBlockAtTime(t *testing.T) {
+	const latest = 1000
+	tests := []struct {
+		name string
+		at   uint64
+		want uint64
+	}{
+		{"before genesis", testBlockTime(0) - 1, 0},
+		{"genesis", testBlockTime(0), 0},
+		{"exact block", testBlockTime(7), 7},
+		{"between blocks", testBlockTime(7) + 5, 7},
+		{"interval changed", testBlockTime(500) + 2, 500},
+		{"last block before latest", testBlockTime(latest) - 1, latest - 1},
+		{"latest", testBlockTime(latest), latest},
+		{"after latest", testBlockTime(latest) + 3600, latest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got, err := searchBlockAtTime(context.Background(), testHeaders(latest, &calls), time.Unix(int64(tt.at), 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("block = %d, want %d", got, tt.want)
+			}
+			// 最新块加二分查找，不超过 log2(1000) + 2 次
+			if calls > 12 {
+				t.Fatalf("%d header queries", calls)
+			}
+		})
+	}
+}
+
+func TestSearchBlockAtTimeError(t *testing.T) {
+	fail := errors.New("rate limited")
+	calls := 0
+	headers := func(ctx context.Context, number *big.Int) (*types.Header, error) {
+		calls++
+		if calls == 3 {
+			return nil, fail
+		}
+		return testHeaders(1000, new(int))(ctx, number)
+	}
+	if _, err := searchBlockAtTime(context.Background(), headers, time.Unix(int64(testBlockTime(10)), 0)); !errors.Is(err, fail) {
+		t.Fatalf("err = %v, want %v", err, fail)
+	}
+}
+
+// packEvent 按 abi 编码事件的非 indexed 参数
+func packEvent(t *testing.T, event abi.Event, values ...interface{}) []byte {
+	t.Helper()
+	data, err := event.Inputs.NonIndexed().Pack(values...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeTransferStarted(t *testing.T) {
+	abis := testAbis(t)
+	c := &Client{abis: abis}
+	diamond := common.HexToAddress("0x7E88c5E7134E4589F6316636CA8Fe8Cc9f8ED505")
+	chain := Chain{Name: "goerli", SoDiamond: diamond.Hex()}
+	event := abis.diamond.Events[eventSoTransferStarted]
+
+	transactionId := common.HexToHash("0x0102030000000000000000000000000000000000000000000000000000000abc")
+	soData := SoData{
+		TransactionId:      transactionId,
+		Receiver:           common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"),
+		SourceChainId:      big.NewInt(5),
+		DestinationChainId: big.NewInt(43113),
+		ReceivingAssetId:   common.HexToAddress("0x5592EC0cfb4dbc12D3aB100b257153436a1f0FEa"),
+		Amount:             big.NewInt(1e16),
+	}
+	txHash := common.HexToHash("0xaa")
+	started := &types.Log{
+		Address:     diamond,
+		Topics:      []common.Hash{event.ID, transactionId},
+		Data:        packEvent(t, event, "Stargate", true, false, soData),
+		TxHash:      txHash,
+		BlockNumber: 123,
+	}
+	// 其他合约发出的同名事件和 SoDiamond 的其他事件都应跳过
+	other := *started
+	other.Address = common.HexToAddress("0x01")
+	other.Data = packEvent(t, event, "Fake", false, false, soData)
+	transfer := &types.Log{Address: diamond, Topics: []common.Hash{common.HexToHash("0xddf252ad"), transactionId}}
+
+	got, err := c.decodeTransferStarted(chain, &types.Receipt{Logs: []*types.Log{&other, transfer, started}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TransactionId != transactionId || got.Bridge != "Stargate" || !got.HasSourceSwap || got.HasDestinationSwap {
+		t.Fatalf("decoded %+v", got)
+	}
+	if got.TxHash != txHash || got.BlockNumber != 123 {
+		t.Fatalf("tx %s block %d", got.TxHash.Hex(), got.BlockNumber)
+	}
+	if got.SoData.DestinationChainId.Cmp(soData.DestinationChainId) != 0 || got.SoData.Receiver != soData.Receiver || got.SoData.Amount.Cmp(soData.Amount) != 0 {
+		t.Fatalf("SoData = %+v", got.SoData)
+	}
+
+	if _, err = c.decodeTransferStarted(chain, &types.Receipt{Logs: []*types.Log{&other, transfer}}); !errors.Is(err, errNoTransferStarted) {
+		t.Fatalf("err = %v, want errNoTransferStarted", err)
+	}
+	noTopic := *started
+	noTopic.Topics = noTopic.Topics[:1]
+	if _, err = c.decodeTransferStarted(chain, &types.Receipt{Logs: []*types.Log{&noTopic}}); !errors.Is(err, errNoTransferStarted) {
+		t.Fatalf("err = %v, want errNoTransferStarted", err)
+	}
+	truncated := *started
+	truncated.Data = truncated.Data[:64]
+	if _, err = c.decodeTransferStarted(chain, &types.Receipt{Logs: []*types.Log{&truncated}}); err == nil || errors.Is(err, errNoTransferStarted) {
+		t.Fatalf("err = %v, want a decode error", err)
+	}
+}
+
+// fakeDstNode 模拟目标链节点，第 deliveredAt 块有 SoTransferCompleted 事件
+type fakeDstNode struct {
+	latest      uint64
+	delivered   types.Log
+	deliveredAt uint64
+
+	mu        sync.Mutex
+	fromBlock []uint64 // eth_getLogs 查询的起始块
+}
+
+type fakeFilter struct {
+	FromBlock hexutil.Uint64  `json:"fromBlock"`
+	ToBlock   hexutil.Uint64  `json:"toBlock"`
+	Topics    [][]common.Hash `json:"topics"`
+}
+
+func (n *fakeDstNode) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(n.latest)
+}
+
+func (n *fakeDstNode) GetBlockByNumber(number rpc.BlockNumber, full bool) *types.Header {
+	if number < 0 {
+		return testHeader(n.latest)
+	}
+	return testHeader(uint64(number))
+}
+
+func (n *fakeDstNode) GetBlockByHash(hash common.Hash, full bool) *types.Header {
+	if header := testHeader(n.deliveredAt); header.Hash() == hash {
+		return header
+	}
+	return nil
+}
+
+func (n *fakeDstNode) GetLogs(filter fakeFilter) []types.Log {
+	n.mu.Lock()
+	n.fromBlock = append(n.fromBlock, uint64(filter.FromBlock))
+	n.mu.Unlock()
+	if uint64(filter.FromBlock) > n.deliveredAt || uint64(filter.ToBlock) < n.deliveredAt {
+		return []types.Log{}
+	}
+	if len(filter.Topics) < 2 || len(filter.Topics[1]) != 1 || filter.Topics[1][0] != n.delivered.Topics[1] {
+		return []types.Log{}
+	}
+	return []types.Log{n.delivered}
+}
+
+func TestWaitTransferDelivered(t *testing.T) {
+	abis := testAbis(t)
+	diamond := common.HexToAddress("0x7E88c5E7134E4589F6316636CA8Fe8Cc9f8ED505")
+	completed := abis.diamond.Events[eventSoTransferCompleted]
+	transactionId := common.HexToHash("0x0abc")
+	receiver := common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")
+	asset := common.HexToAddress("0x5592EC0cfb4dbc12D3aB100b257153436a1f0FEa")
+	soData := SoData{
+		TransactionId:      transactionId,
+		Receiver:           receiver,
+		SourceChainId:      big.NewInt(5),
+		DestinationChainId: big.NewInt(43113),
+		ReceivingAssetId:   asset,
+		Amount:             big.NewInt(1e16),
+	}
+
+	node := &fakeDstNode{latest: 1000, deliveredAt: 600}
+	node.delivered = types.Log{
+		Address:     diamond,
+		Topics:      []common.Hash{completed.ID, transactionId},
+		Data:        packEvent(t, completed, asset, receiver, big.NewInt(9e15), big.NewInt(int64(testBlockTime(600))), soData),
+		BlockNumber: 600,
+		TxHash:      common.HexToHash("0xbb"),
+		BlockHash:   testHeader(600).Hash(),
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	dst := httptest.NewServer(server)
+	defer dst.Close()
+
+	fromChain := testChain("goerli", 5, 10021, "http://127.0.0.1:1", diamond)
+	toChain := testChain("fuji", 43113, 10006, dst.URL, diamond)
+	client := testClient(t, []Chain{fromChain, toChain}, WatchOptions{PollInterval: 20 * time.Millisecond})
+	defer client.Shutdown(context.Background())
+
+	srcTime := time.Unix(int64(testBlockTime(400))+1, 0)
+	started := &TransferStarted{TransactionId: transactionId, Bridge: "Stargate", SoData: soData, Time: srcTime}
+	transfer, err := client.waitTransferDelivered(context.Background(), fromChain, toChain, started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 从源链交易时间对应的目标链块开始查找
+	if len(node.fromBlock) == 0 || node.fromBlock[0] != 400 {
+		t.Fatalf("logs queried from %v, want block 400", node.fromBlock)
+	}
+	if transfer.Status != TransferCompleted || transfer.Receiver != receiver || transfer.ReceivingAssetId != asset || transfer.ReceiveAmount.Cmp(big.NewInt(9e15)) != 0 {
+		t.Fatalf("transfer = %+v", transfer)
+	}
+	if transfer.FromChain != "goerli" || transfer.ToChain != "fuji" || transfer.DstBlockNumber != 600 || transfer.DstTxHash != node.delivered.TxHash {
+		t.Fatalf("transfer = %+v", transfer)
+	}
+	if want := time.Duration(testBlockTime(600)-testBlockTime(400)-1) * time.Second; transfer.Latency != want {
+		t.Fatalf("latency = %s, want %s", transfer.Latency, want)
+	}
+
+	// 目标链一直没有到账事件时超时
+	client.watch.DeliveryTimeout = 100 * time.Millisecond
+	other := *started
+	other.TransactionId = common.HexToHash("0x0def")
+	if _, err = client.waitTransferDelivered(context.Background(), fromChain, toChain, &other); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
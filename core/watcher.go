@@ -0,0 +1,347 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"so-omnichain-example/connpool"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/fatih/color"
+)
+
+const (
+	defaultConfirmations = 1
+	defaultWatchTimeout  = 10 * time.Minute
+	defaultPollInterval  = 3 * time.Second
+	// defaultDroppedAfter 交易既不在交易池也没有回执超过此时间，认为交易被丢弃
+	defaultDroppedAfter = time.Minute
+	// maxWatchErrors 连续 rpc 错误超过此次数，停止等待并返回错误
+	maxWatchErrors = 5
+	// defaultMaxSpeedUps 自动加速的默认最多次数
+	defaultMaxSpeedUps = 3
+)
+
+// TxStatus 交易最终状态
+type TxStatus int
+
+const (
+	TxSuccess  TxStatus = iota // 上链成功
+	TxReverted                 // 上链但执行失败
+	TxDropped                  // 交易不在交易池中且 nonce 未被使用
+	TxReplaced                 // 相同 nonce 的其他交易已上链
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxSuccess:
+		return "success"
+	case TxReverted:
+		return "reverted"
+	case TxDropped:
+		return "dropped"
+	case TxReplaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("TxStatus(%d)", int(s))
+}
+
+// WatchOptions 等待交易上链的参数，零值字段使用默认值
+type WatchOptions struct {
+	Confirmations uint64        // 确认块数，默认 1，即交易所在块
+	Timeout       time.Duration // 超时时间，默认 10 分钟
+	PollInterval  time.Duration // 轮询间隔，默认 3 秒
+	DroppedAfter  time.Duration // 交易从节点消失多久后认为被丢弃，默认 1 分钟
+
+	DeliveryTimeout time.Duration // 跨链交易等待目标链到账的超时时间，默认 30 分钟
+
+	// 自动加速：签名账户发送的交易 pending 超过 SpeedUpAfter 时，使用相同 nonce 提高 gas 费重新发送
+	SpeedUpAfter time.Duration // 为 0 时不自动加速
+	FeeBump      int           // 每次加速 gas 费提高的百分比，默认 12，小于 10 时按 10 处理
+	MaxSpeedUps  int           // 最多加速次数，默认 3
+}
+
+func (o WatchOptions) withDefaults() WatchOptions {
+	if o.Confirmations == 0 {
+		o.Confirmations = defaultConfirmations
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultWatchTimeout
+	}
+	if o.PollInterval == 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.DroppedAfter == 0 {
+		o.DroppedAfter = defaultDroppedAfter
+	}
+	if o.FeeBump == 0 {
+		o.FeeBump = defaultFeeBump
+	} else if o.FeeBump < minFeeBump {
+		o.FeeBump = minFeeBump
+	}
+	if o.MaxSpeedUps == 0 {
+		o.MaxSpeedUps = defaultMaxSpeedUps
+	}
+	return o
+}
+
+// TxResult 等待交易的结果，Dropped 和 Replaced 时 Receipt 及 Block 为空
+// 交易被自动加速时 Hash 为最终上链的交易
+type TxResult struct {
+	Hash              common.Hash
+	Status            TxStatus
+	Receipt           *types.Receipt
+	Block             *types.Header
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	Confirmations     uint64
+}
+
+// Fee 交易实际花费的手续费
+func (r *TxResult) Fee() *big.Int {
+	if r.EffectiveGasPrice == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Mul(r.EffectiveGasPrice, new(big.Int).SetUint64(r.GasUsed))
+}
+
+// WaitForTx 等待 chain 上的交易达到确认块数，或者确认交易被丢弃、替换
+// 超时或 ctx 取消时返回错误，交易执行失败不返回错误，通过 TxResult.Status 区分
+func (c *Client) WaitForTx(ctx context.Context, chain string, txHash string) (*TxResult, error) {
+	chainInfo, err := c.getChainInfo(chain)
+	if err != nil {
+		return nil, err
+	}
+	return c.watchTx(ctx, chainInfo, common.HexToHash(txHash), c.watch)
+}
+
+// waitForTxSuccess 等待交易上链，除 TxSuccess 外都返回错误
+func (c *Client) waitForTxSuccess(ctx context.Context, chain Chain, txHash string) (*TxResult, error) {
+	c.logger.Printf("%s\n", color.HiYellowString("wait tx %s", txHash))
+	result, err := c.watchTx(ctx, chain, common.HexToHash(txHash), c.watch)
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != TxSuccess {
+		c.logger.Printf("%s\n", color.HiRedString("tx %s %s", result.Status, result.Hash.Hex()))
+		return result, fmt.Errorf("transaction %s: %s", result.Status, result.Hash.Hex())
+	}
+	c.logger.Printf("%s\n", color.HiGreenString("tx success %s block %d gas used %d effective gas price %s",
+		result.Hash.Hex(), result.Receipt.BlockNumber, result.GasUsed, result.EffectiveGasPrice))
+	return result, nil
+}
+
+// txWatch 等待过程中的状态
+type txWatch struct {
+	hash     common.Hash
+	tx       *types.Transaction // 从节点获取到的交易，用于判断 nonce 是否已被使用
+	from     common.Address
+	lastSeen time.Time
+	errCount int
+
+	pending  bool                 // 最近一次查询时交易在交易池中
+	replaced []*types.Transaction // 被自动加速替换的交易，仍可能先于新交易上链
+	sentAt   time.Time            // 开始等待或最近一次加速的时间
+}
+
+func (c *Client) watchTx(ctx context.Context, chain Chain, txHash common.Hash, opts WatchOptions) (*TxResult, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	pool := c.getConnectPool(chain)
+	w := &txWatch{hash: txHash, lastSeen: time.Now(), sentAt: time.Now()}
+	// websocket 地址在出新块时立即查询，http 地址按 PollInterval 轮询
+	newBlock := c.newBlockNotifier(ctx, chain, opts.PollInterval)
+	for {
+		var result *TxResult
+		err := pool.Read(ctx, func(c1 *ethclient.Client, _ *rpc.Client) error {
+			var err error
+			result, err = w.poll(ctx, c1, opts)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("wait tx %s: %w", txHash.Hex(), ctx.Err())
+			}
+			if errors.Is(err, connpool.ErrPoolClosed) {
+				return nil, fmt.Errorf("wait tx %s: %w", txHash.Hex(), err)
+			}
+			w.errCount++
+			if w.errCount >= maxWatchErrors {
+				return nil, fmt.Errorf("wait tx %s: %w", txHash.Hex(), err)
+			}
+			c.logger.Printf("wait tx %s: %s\n", txHash.Hex(), err)
+		} else {
+			w.errCount = 0
+		}
+		if result != nil {
+			return result, nil
+		}
+		if err == nil && c.shouldSpeedUp(w, opts) {
+			c.speedUp(ctx, chain, w, opts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait tx %s: %w", txHash.Hex(), ctx.Err())
+		case <-newBlock:
+		}
+	}
+}
+
+// shouldSpeedUp 交易由签名账户发送、仍在交易池中且 pending 超过 SpeedUpAfter 时自动加速
+func (c *Client) shouldSpeedUp(w *txWatch, opts WatchOptions) bool {
+	if opts.SpeedUpAfter <= 0 || !w.pending || len(w.replaced) >= opts.MaxSpeedUps || c.account == nil {
+		return false
+	}
+	return w.from == c.account.Address() && time.Since(w.sentAt) >= opts.SpeedUpAfter
+}
+
+// speedUp 使用相同 nonce 提高 gas 费重新发送交易，之后同时等待新旧交易
+// 发送失败时只输出错误，过 SpeedUpAfter 后再次尝试
+func (c *Client) speedUp(ctx context.Context, chain Chain, w *txWatch, opts WatchOptions) {
+	w.sentAt = time.Now()
+	tx, err := c.replaceTx(ctx, chain, w.tx, false, opts.FeeBump)
+	if err != nil {
+		c.logger.Printf("speed up tx %s: %s\n", w.hash.Hex(), err)
+		return
+	}
+	w.replaced = append(w.replaced, w.tx)
+	w.hash, w.tx = tx.Hash(), tx
+	w.pending = false
+	w.lastSeen = time.Now()
+}
+
+// poll 查询一次交易状态，交易未达到最终状态时返回 nil
+func (w *txWatch) poll(ctx context.Context, client *ethclient.Client, opts WatchOptions) (*TxResult, error) {
+	w.pending = false
+	receipt, err := w.receipt(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if receipt != nil {
+		return w.confirmed(ctx, client, receipt, opts)
+	}
+
+	// 没有回执：交易在交易池中，或者被丢弃、替换
+	tx, isPending, err := client.TransactionByHash(ctx, w.hash)
+	if err == nil {
+		w.pending = isPending
+		if w.tx == nil {
+			from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+			if err != nil {
+				return nil, err
+			}
+			w.tx, w.from = tx, from
+		}
+		w.lastSeen = time.Now()
+		return nil, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return nil, err
+	}
+	if w.tx != nil {
+		// 账户已上链的 nonce 超过交易 nonce，说明相同 nonce 的其他交易已上链
+		nonce, err := client.NonceAt(ctx, w.from, nil)
+		if err != nil {
+			return nil, err
+		}
+		if nonce > w.tx.Nonce() {
+			// 查询回执之后交易本身或加速前的交易可能刚刚上链，再查一次回执，避免把自己的交易当成被替换
+			receipt, err := w.receipt(ctx, client)
+			if err != nil {
+				return nil, err
+			}
+			if receipt != nil {
+				return w.confirmed(ctx, client, receipt, opts)
+			}
+			return &TxResult{Hash: w.hash, Status: TxReplaced}, nil
+		}
+	}
+	if time.Since(w.lastSeen) >= opts.DroppedAfter {
+		return &TxResult{Hash: w.hash, Status: TxDropped}, nil
+	}
+	return nil, nil
+}
+
+// receipt 依次查询当前交易及加速前交易的回执，加速前的交易可能先上链，此时切换为等待该交易；都没有回执时返回 nil
+func (w *txWatch) receipt(ctx context.Context, client *ethclient.Client) (*types.Receipt, error) {
+	receipt, err := client.TransactionReceipt(ctx, w.hash)
+	if err == nil {
+		return receipt, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return nil, err
+	}
+	for _, old := range w.replaced {
+		receipt, err := client.TransactionReceipt(ctx, old.Hash())
+		if err == nil {
+			w.hash, w.tx = old.Hash(), old
+			return receipt, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// confirmed 交易已有回执，达到确认块数后返回结果
+func (w *txWatch) confirmed(ctx context.Context, client *ethclient.Client, receipt *types.Receipt, opts WatchOptions) (*TxResult, error) {
+	latest, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blockNumber := receipt.BlockNumber.Uint64()
+	if latest < blockNumber || latest-blockNumber+1 < opts.Confirmations {
+		return nil, nil
+	}
+	header, err := client.HeaderByHash(ctx, receipt.BlockHash)
+	if err != nil {
+		// 回执所在的块已被重组，下次轮询重新获取回执
+		if errors.Is(err, ethereum.NotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tx := w.tx
+	if tx == nil {
+		tx, _, err = client.TransactionByHash(ctx, w.hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	status := TxSuccess
+	if receipt.Status == types.ReceiptStatusFailed {
+		status = TxReverted
+	}
+	return &TxResult{
+		Hash:              w.hash,
+		Status:            status,
+		Receipt:           receipt,
+		Block:             header,
+		GasUsed:           receipt.GasUsed,
+		EffectiveGasPrice: effectiveGasPrice(tx, header.BaseFee),
+		Confirmations:     latest - blockNumber + 1,
+	}, nil
+}
+
+// effectiveGasPrice 计算交易实际的 gas price
+// 当前 go-ethereum 版本的回执没有 EffectiveGasPrice 字段，需要根据交易及块的 base fee 计算
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return tx.GasPrice()
+	}
+	tip, err := tx.EffectiveGasTip(baseFee)
+	if err != nil {
+		return tx.GasFeeCap()
+	}
+	return tip.Add(tip, baseFee)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+
+	"so-omnichain-example/signer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01166c2b111"
+
+// fakeWatchNode 模拟节点：交易在 eth_getTransactionCount 查询时上链，即 poll 查询回执之后、判断 nonce 之前
+type fakeWatchNode struct {
+	mu       sync.Mutex
+	minedTx  common.Hash // 查询 nonce 后上链的交易
+	mined    bool
+	nonce    uint64 // 上链后账户的 nonce
+	header   *types.Header
+	receipts int // eth_getTransactionReceipt 的调用次数
+}
+
+func (n *fakeWatchNode) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.receipts++
+	if !n.mined || hash != n.minedTx {
+		return nil, nil
+	}
+	return &types.Receipt{
+		Status:      types.ReceiptStatusSuccessful,
+		Logs:        []*types.Log{},
+		TxHash:      hash,
+		GasUsed:     21000,
+		BlockHash:   n.header.Hash(),
+		BlockNumber: n.header.Number,
+	}, nil
+}
+
+func (n *fakeWatchNode) GetTransactionByHash(hash common.Hash) (*types.Transaction, error) {
+	// 新旧交易都已不在交易池中
+	return nil, nil
+}
+
+func (n *fakeWatchNode) GetTransactionCount(account common.Address, block string) (hexutil.Uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.mined = true
+	return hexutil.Uint64(n.nonce), nil
+}
+
+func (n *fakeWatchNode) BlockNumber() (hexutil.Uint64, error) {
+	return hexutil.Uint64(n.header.Number.Uint64()), nil
+}
+
+func (n *fakeWatchNode) GetBlockByHash(hash common.Hash, full bool) (*types.Header, error) {
+	if hash != n.header.Hash() {
+		return nil, nil
+	}
+	return n.header, nil
+}
+
+func signTestTx(t *testing.T, account signer.Signer, nonce uint64, tip int64) *types.Transaction {
+	t.Helper()
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	tx, err := account.SignTx(types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(5),
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(tip),
+		GasFeeCap: big.NewInt(100 * tip),
+		Gas:       21000,
+		To:        &to,
+	}), big.NewInt(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestPollOriginalMinedAfterSpeedUp(t *testing.T) {
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := signTestTx(t, account, 3, 1e9)
+	speedUp := signTestTx(t, account, 3, 2e9)
+
+	node := &fakeWatchNode{
+		minedTx: original.Hash(),
+		nonce:   4,
+		header: &types.Header{
+			Number:     big.NewInt(100),
+			Difficulty: big.NewInt(0),
+			BaseFee:    big.NewInt(1e9),
+			Extra:      []byte{},
+		},
+	}
+	server := rpc.NewServer()
+	if err = server.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	defer client.Close()
+
+	w := &txWatch{
+		hash:     speedUp.Hash(),
+		tx:       speedUp,
+		from:     account.Address(),
+		replaced: []*types.Transaction{original},
+	}
+	result, err := w.poll(context.Background(), client, WatchOptions{}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil || result.Status != TxSuccess {
+		t.Fatalf("result %+v, want the original tx reported as success", result)
+	}
+	if result.Hash != original.Hash() {
+		t.Fatalf("hash %s, want the original tx %s", result.Hash.Hex(), original.Hash().Hex())
+	}
+	if want := big.NewInt(2e9); result.EffectiveGasPrice.Cmp(want) != 0 {
+		t.Fatalf("effective gas price %s, want %s", result.EffectiveGasPrice, want)
+	}
+}
+
+func TestPollReplacedByOtherTx(t *testing.T) {
+	account, err := signer.NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := signTestTx(t, account, 3, 1e9)
+
+	// 相同 nonce 的其他交易上链，自己的交易始终没有回执
+	node := &fakeWatchNode{
+		minedTx: common.HexToHash("0x01"),
+		nonce:   4,
+		header:  &types.Header{Number: big.NewInt(100), Difficulty: big.NewInt(0), Extra: []byte{}},
+	}
+	server := rpc.NewServer()
+	if err = server.RegisterName("eth", node); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	client := ethclient.NewClient(rpc.DialInProc(server))
+	defer client.Close()
+
+	w := &txWatch{hash: tx.Hash(), tx: tx, from: account.Address()}
+	result, err := w.poll(context.Background(), client, WatchOptions{}.withDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result == nil || result.Status != TxReplaced {
+		t.Fatalf("result %+v, want TxReplaced", result)
+	}
+	// nonce 已被使用后再次确认没有回执
+	if node.receipts != 2 {
+		t.Fatalf("receipt queried %d times, want 2", node.receipts)
+	}
+}
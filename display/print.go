@@ -16,3 +16,10 @@ func PrintlnWithTime(args ...interface{}) {
 	args = append([]interface{}{time.Now().Format(TimeFormat)}, args...)
 	fmt.Println(args...)
 }
+
+// Logger 带时间前缀输出到标准输出
+type Logger struct{}
+
+func (Logger) Printf(format string, args ...interface{}) {
+	PrintfWithTime(format, args...)
+}
@@ -1,26 +1,540 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"so-omnichain-example/abi"
 	"so-omnichain-example/core"
+	"so-omnichain-example/signer"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/fatih/color"
+	"golang.org/x/term"
 )
 
+const usage = `usage: so-omnichain-example [command] [flags]
+
+commands:
+  swap      sign and send the swap transactions (default)
+  quote     estimate the swap without signing or sending anything
+  export    write the unsigned approve and swap transactions to files
+  broadcast send externally signed transactions and wait for them
+  speedup   resend a pending transaction with the same nonce and a higher fee
+  cancel    replace a pending transaction with a zero value transfer to self
+  track     decode a swap transaction, by tx hash or TransactionId, and follow it to the destination chain
+  decode    decode calldata or a transaction's input against the built-in abis
+
+run "so-omnichain-example <command> -h" for flags.
+`
+
+// shutdownTimeout 收到退出信号后等待进行中的 rpc 调用结束的时间
+const shutdownTimeout = 10 * time.Second
+
+// clients newClient 创建的 Client，退出时关闭其连接池
+var clients struct {
+	sync.Mutex
+	list []*core.Client
+}
+
 func main() {
+	cmd := "swap"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	// 收到 SIGINT/SIGTERM 时取消命令的 ctx，进行中的等待和 rpc 调用随之返回
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// NotifyContext 不返回收到的信号，另外记录信号用于计算退出码
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- run(ctx, cmd, args)
+	}()
+
 	var (
-		fromChain = flag.String("fc", "rinkeby", "from chain")
-		toChain   = flag.String("tc", "polygon-test", "to chain")
-		fromToken = flag.String("ft", "usdc", "from token")
-		toToken   = flag.String("tt", "usdc", "to token")
+		err error
+		sig syscall.Signal
 	)
-	flag.Parse()
+	select {
+	case err = <-errc:
+		_ = shutdownClients(context.Background())
+	case <-ctx.Done():
+		// 再次收到信号时直接退出
+		stop()
+		signal.Stop(sigs)
+		sig = receivedSignal(sigs)
+		fmt.Println(color.YellowString("received %s, shutting down", sig))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		if shutdownErr := shutdownClients(shutdownCtx); shutdownErr != nil {
+			fmt.Println(color.HiRedString("shutdown: %s", shutdownErr))
+		}
+		// 连接池关闭后进行中的命令会很快返回，等它输出结果
+		select {
+		case err = <-errc:
+		case <-shutdownCtx.Done():
+		}
+		cancel()
+	}
+	exitCode := 1
+	if ctx.Err() != nil {
+		// 命令返回的同时收到信号
+		if sig == 0 {
+			sig = receivedSignal(sigs)
+		}
+		err = fmt.Errorf("interrupted by %s", sig)
+		// 与 shell 约定一致，被信号中断时退出码为 128 + 信号值，SIGINT 为 130
+		exitCode = 128 + int(sig)
+	}
+	if err != nil {
+		fmt.Println(color.HiRedString("Error: %s", err))
+		os.Exit(exitCode)
+	}
+}
 
-	fmt.Println(color.HiBlueString("%s %s -->> %s %s", *fromChain, *fromToken, *toChain, *toToken))
+// receivedSignal 返回取消命令 ctx 的信号
+// 信号同时发给 NotifyContext 和 sigs，sigs 稍晚收到时短暂等待，仍收不到按 SIGINT 处理
+func receivedSignal(sigs <-chan os.Signal) syscall.Signal {
+	select {
+	case sig := <-sigs:
+		if s, ok := sig.(syscall.Signal); ok {
+			return s
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+	return syscall.SIGINT
+}
+
+func run(ctx context.Context, cmd string, args []string) error {
+	switch cmd {
+	case "swap":
+		return runSwap(ctx, args)
+	case "quote":
+		return runQuote(ctx, args)
+	case "export":
+		return runExport(ctx, args)
+	case "broadcast":
+		return runBroadcast(ctx, args)
+	case "speedup":
+		return runReplace(ctx, args, false)
+	case "cancel":
+		return runReplace(ctx, args, true)
+	case "track":
+		return runTrack(ctx, args)
+	case "decode":
+		return runDecode(ctx, args)
+	}
+	fmt.Print(usage)
+	return fmt.Errorf("unknown command %s", cmd)
+}
+
+// shutdownClients 关闭所有 Client 的连接池，等待进行中的 rpc 调用结束
+func shutdownClients(ctx context.Context) error {
+	clients.Lock()
+	defer clients.Unlock()
+	var err error
+	for _, client := range clients.list {
+		if shutdownErr := client.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
 
-	err := core.Swap(*fromChain, *toChain, *fromToken, *toToken)
+func runSwap(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("swap", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	loadSigner := signerFlags(fs)
+	request := swapRequestFlags(fs)
+	_ = fs.Parse(args)
+
+	req := request()
+	printRoute(req)
+	account, err := loadSigner(ctx)
 	if err != nil {
-		fmt.Println(color.HiRedString("Error: %s", err))
+		return err
+	}
+	client, err := newClient(clientFlags, account)
+	if err != nil {
+		return err
+	}
+	return client.Swap(ctx, req)
+}
+
+func runQuote(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("quote", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	request := swapRequestFlags(fs)
+	_ = fs.Parse(args)
+
+	req := request()
+	printRoute(req)
+	// 报价不需要签名账户
+	client, err := newClient(clientFlags, nil)
+	if err != nil {
+		return err
+	}
+	quote, err := client.GetQuote(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Print(quote)
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	request := swapRequestFlags(fs)
+	from := fs.String("from", "", "address that will sign and send the transactions")
+	out := fs.String("out", "./txs", "output directory")
+	gasLimit := fs.Uint64("gas-limit", 0, "swap tx gas limit (default: estimated, 1500000 when an approve is needed)")
+	_ = fs.Parse(args)
+
+	if !common.IsHexAddress(*from) {
+		return fmt.Errorf("invalid from address %q", *from)
+	}
+	req := request()
+	printRoute(req)
+	client, err := newClient(clientFlags, nil)
+	if err != nil {
+		return err
+	}
+	bundle, err := client.ExportSwap(ctx, req, core.ExportOptions{
+		From:     common.HexToAddress(*from),
+		GasLimit: *gasLimit,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(bundle.Quote)
+	paths, err := bundle.WriteFiles(*out)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		fmt.Println(color.HiGreenString("wrote %s", path))
+	}
+	return nil
+}
+
+func runBroadcast(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("broadcast", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	chain := fs.String("chain", "", "chain name or chain id (default: networks.default)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: so-omnichain-example broadcast [flags] <signed tx file>...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no signed tx file")
+	}
+	txs, err := core.LoadSignedTxs(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(clientFlags, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Broadcast(ctx, *chain, txs)
+	return err
+}
+
+// runReplace 加速或取消签名账户 pending 的交易，等待替换交易上链
+func runReplace(ctx context.Context, args []string, cancel bool) error {
+	name := "speedup"
+	if cancel {
+		name = "cancel"
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	loadSigner := signerFlags(fs)
+	chain := fs.String("chain", "", "chain name or chain id (default: networks.default)")
+	bump := fs.Int("bump", 12, "raise the tip and fee cap by this percentage, at least 10")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: so-omnichain-example %s [flags] <pending tx hash>\n", name)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expect one pending tx hash")
+	}
+	account, err := loadSigner(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(clientFlags, account)
+	if err != nil {
+		return err
+	}
+	var txHash string
+	if cancel {
+		txHash, err = client.CancelTx(ctx, *chain, fs.Arg(0), *bump)
+	} else {
+		txHash, err = client.SpeedUpTx(ctx, *chain, fs.Arg(0), *bump)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("txHash: %s\n", txHash)
+	result, err := client.WaitForTx(ctx, *chain, txHash)
+	if err != nil {
+		return err
+	}
+	// 原交易先上链时新交易为 replaced
+	fmt.Println(color.HiGreenString("tx %s %s", result.Hash.Hex(), result.Status))
+	return nil
+}
+
+func runTrack(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("track", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	chain := fs.String("chain", "", "source chain name or chain id (default: search all chains)")
+	byId := fs.Bool("id", false, "look up the swap by SoData TransactionId instead of the source tx hash")
+	lookback := fs.Duration("lookback", 7*24*time.Hour, "with -id, search SoTransferStarted events in blocks from this long ago")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: so-omnichain-example track [flags] <source tx hash>")
+		fmt.Fprintln(fs.Output(), "       so-omnichain-example track -id [flags] <transaction id>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		if *byId {
+			return fmt.Errorf("expect one transaction id")
+		}
+		return fmt.Errorf("expect one source tx hash")
+	}
+	client, err := newClient(clientFlags, nil)
+	if err != nil {
+		return err
+	}
+	var trace *core.SwapTrace
+	if *byId {
+		trace, err = client.TraceSwapByTransactionId(ctx, *chain, fs.Arg(0), *lookback)
+	} else {
+		trace, err = client.TraceSwap(ctx, *chain, fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(trace)
+	return nil
+}
+
+func runDecode(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	clientFlags := newClientFlags(fs)
+	chain := fs.String("chain", "", "chain of the tx hash, name or chain id (default: search all chains)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: so-omnichain-example decode [flags] <calldata | tx hash>")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expect calldata or a tx hash")
+	}
+	input, err := hexutil.Decode(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid hex %q: %w", fs.Arg(0), err)
+	}
+	client, err := newClient(clientFlags, nil)
+	if err != nil {
+		return err
+	}
+	var call *core.DecodedCall
+	// 32 字节按交易 hash 处理，calldata 至少是 4 字节 method id 加若干 32 字节参数
+	if len(input) == common.HashLength {
+		call, err = client.DecodeTx(ctx, *chain, fs.Arg(0))
+	} else {
+		call, err = client.DecodeCalldata(input)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(call)
+	return nil
+}
+
+func newClient(flags clientFlags, account signer.Signer) (*core.Client, error) {
+	config, err := core.LoadConfig(*flags.config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := core.NewClient(core.Options{
+		Config: config,
+		Signer: account,
+		ABIs:   abi.WithOverride(*flags.abiDir),
+		Watch: core.WatchOptions{
+			Confirmations:   *flags.confirmations,
+			Timeout:         *flags.txTimeout,
+			DeliveryTimeout: *flags.deliveryTimeout,
+			SpeedUpAfter:    *flags.speedUpAfter,
+			FeeBump:         *flags.feeBump,
+			MaxSpeedUps:     *flags.maxSpeedUps,
+		},
+		PoolSize: *flags.poolSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clients.Lock()
+	clients.list = append(clients.list, client)
+	clients.Unlock()
+	if *flags.metricsAddr != "" {
+		go serveMetrics(*flags.metricsAddr, client)
+	}
+	return client, nil
+}
+
+// serveMetrics 在 addr 的 /metrics 输出 rpc 连接池的 Prometheus 指标
+func serveMetrics(addr string, client *core.Client) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = client.WritePrometheus(w)
+	})
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Println(color.HiRedString("metrics server: %s", err))
+	}
+}
+
+type clientFlags struct {
+	config          *string
+	abiDir          *string
+	confirmations   *uint64
+	txTimeout       *time.Duration
+	deliveryTimeout *time.Duration
+	poolSize        *int
+	metricsAddr     *string
+	speedUpAfter    *time.Duration
+	feeBump         *int
+	maxSpeedUps     *int
+}
+
+func newClientFlags(fs *flag.FlagSet) clientFlags {
+	return clientFlags{
+		config:          fs.String("config", "./config.yaml", "config file path"),
+		abiDir:          fs.String("abi-dir", "", "directory with abi json files overriding the built-in ones"),
+		confirmations:   fs.Uint64("confirmations", 1, "blocks to wait for after a transaction is mined"),
+		txTimeout:       fs.Duration("tx-timeout", 10*time.Minute, "give up waiting for a transaction after this long"),
+		deliveryTimeout: fs.Duration("delivery-timeout", 30*time.Minute, "give up waiting for a cross chain transfer to arrive after this long"),
+		poolSize:        fs.Int("pool-size", 2, "maximum connections per rpc endpoint"),
+		metricsAddr:     fs.String("metrics-addr", "", "serve rpc pool metrics in prometheus format on this address, e.g. :9100"),
+		speedUpAfter:    fs.Duration("speed-up-after", 0, "resend our transactions with a higher fee when pending this long, e.g. 2m (default: never)"),
+		feeBump:         fs.Int("fee-bump", 12, "fee increase in percent for each automatic speed up, at least 10"),
+		maxSpeedUps:     fs.Int("max-speed-ups", 3, "maximum automatic speed ups per transaction"),
 	}
 }
+
+// signerFlags 注册签名参数，fs 解析完成后调用返回的函数加载 Signer
+// 优先使用 -signer-url 外部签名服务，其次 -keystore，然后环境变量 private_key，最后环境变量 words 助记词
+func signerFlags(fs *flag.FlagSet) func(ctx context.Context) (signer.Signer, error) {
+	var (
+		signerUrl     = fs.String("signer-url", "", "clef compatible external signer endpoint, e.g. http://localhost:8550")
+		signerAddress = fs.String("signer-address", "", "account of the external signer (default: first of account_list)")
+		signerTimeout = fs.Duration("signer-timeout", signer.DefaultSignTimeout, "give up waiting for the external signer to connect or sign after this long")
+		keystorePath  = fs.String("keystore", "", "geth keystore json file, passphrase is read from env passphrase or prompted")
+		hdPath        = fs.String("hd-path", "", "mnemonic derivation path (default: "+signer.DefaultDerivationPath+")")
+		accountIndex  = fs.Int("account-index", 0, "mnemonic account index, ignored when -hd-path is set")
+	)
+	return func(ctx context.Context) (signer.Signer, error) {
+		if *signerUrl != "" {
+			if *signerAddress != "" && !common.IsHexAddress(*signerAddress) {
+				return nil, fmt.Errorf("invalid signer address %s", *signerAddress)
+			}
+			ctx, cancel := context.WithTimeout(ctx, *signerTimeout)
+			defer cancel()
+			external, err := signer.DialExternalSigner(ctx, *signerUrl, common.HexToAddress(*signerAddress))
+			if err != nil {
+				return nil, err
+			}
+			external.Timeout = *signerTimeout
+			return external, nil
+		}
+		if *keystorePath != "" {
+			keyJson, err := os.ReadFile(*keystorePath)
+			if err != nil {
+				return nil, err
+			}
+			passphrase, err := readPassphrase()
+			if err != nil {
+				return nil, err
+			}
+			return signer.NewKeystoreSigner(keyJson, passphrase)
+		}
+		if privateKey := os.Getenv("private_key"); privateKey != "" {
+			return signer.NewPrivateKeySigner(privateKey)
+		}
+		path := *hdPath
+		if path == "" {
+			path = signer.DerivationPathForIndex(*accountIndex)
+		}
+		return signer.NewMnemonicSigner(os.Getenv("words"), path)
+	}
+}
+
+func readPassphrase() (string, error) {
+	if passphrase, ok := os.LookupEnv("passphrase"); ok {
+		return passphrase, nil
+	}
+	fmt.Print("keystore passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
+
+// swapRequestFlags 注册 swap 参数，fs 解析完成后调用返回的函数得到 SwapRequest
+func swapRequestFlags(fs *flag.FlagSet) func() core.SwapRequest {
+	var (
+		fromChain = fs.String("fc", "", "from chain, name or chain id (default: networks.default)")
+		toChain   = fs.String("tc", "polygon-test", "to chain, name or chain id")
+		fromToken = fs.String("ft", "usdc", "from token")
+		toToken   = fs.String("tt", "usdc", "to token")
+		amount    = fs.String("amount", "", "from token amount, e.g. 12.5 (default: tokens.<ft>.amount in config)")
+		rawAmount = fs.Bool("wei", false, "treat -amount as raw integer amount in the token's smallest unit")
+		receiver  = fs.String("receiver", "", "receiver address on the destination chain (default: signer address)")
+		slippage  = fs.Float64("slippage", 0, "slippage, e.g. 0.01 for 1% (default: 0.005 same chain, 0.01 cross chain)")
+		deadline  = fs.Duration("deadline", 0, "uniswap swap deadline, e.g. 30m (default: 1h)")
+	)
+	return func() core.SwapRequest {
+		return core.SwapRequest{
+			FromChain: *fromChain,
+			ToChain:   *toChain,
+			FromToken: *fromToken,
+			ToToken:   *toToken,
+			Amount:    core.Amount{Value: *amount, Raw: *rawAmount},
+			Receiver:  *receiver,
+			Slippage:  *slippage,
+			Deadline:  *deadline,
+		}
+	}
+}
+
+func printRoute(req core.SwapRequest) {
+	fmt.Println(color.HiBlueString("%s %s %s -->> %s %s", req.FromChain, req.Amount.Value, req.FromToken, req.ToChain, req.ToToken))
+}
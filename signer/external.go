@@ -0,0 +1,145 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const (
+	methodAccountList            = "account_list"
+	methodAccountSignTransaction = "account_signTransaction"
+)
+
+// DefaultSignTimeout 等待外部签名服务返回签名结果的默认时间，clef 需要人工确认，留出足够的时间
+const DefaultSignTimeout = 2 * time.Minute
+
+// SignTxResult account_signTransaction 的返回值
+type SignTxResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// ExternalSigner 把未签名交易发送给外部签名服务签名
+// 外部签名服务需要兼容 clef 的 account_signTransaction json-rpc 接口
+type ExternalSigner struct {
+	client  *rpc.Client
+	address common.Address
+	// Timeout 单次签名请求的超时时间，为 0 时使用 DefaultSignTimeout
+	Timeout time.Duration
+}
+
+// DialExternalSigner 连接外部签名服务，address 为空时使用 account_list 返回的第一个账户
+func DialExternalSigner(ctx context.Context, endpoint string, address common.Address) (*ExternalSigner, error) {
+	client, err := rpc.DialContext(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if address == (common.Address{}) {
+		var list []common.Address
+		if err = client.CallContext(ctx, &list, methodAccountList); err != nil {
+			client.Close()
+			return nil, err
+		}
+		if len(list) == 0 {
+			client.Close()
+			return nil, errors.New("external signer has no account")
+		}
+		address = list[0]
+	}
+	return NewExternalSigner(client, address), nil
+}
+
+// NewExternalSigner 使用已经建立的 rpc 连接构造 ExternalSigner，测试时可以配合 NewLocalSignerServer 使用 rpc.DialInProc
+func NewExternalSigner(client *rpc.Client, address common.Address) *ExternalSigner {
+	return &ExternalSigner{
+		client:  client,
+		address: address,
+	}
+}
+
+func (s *ExternalSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *ExternalSigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	args := newSendTxArgs(s.address, tx, chainId)
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = DefaultSignTimeout
+	}
+	// Signer 接口没有 ctx，签名服务无响应时不能一直等待
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var result SignTxResult
+	// SendTxArgs 的地址字段只有指针实现了 MarshalJSON，需要传指针
+	err := s.client.CallContext(ctx, &result, methodAccountSignTransaction, &args, nil)
+	if err != nil {
+		return nil, err
+	}
+	signedTx := new(types.Transaction)
+	if err = signedTx.UnmarshalBinary(result.Raw); err != nil {
+		return nil, err
+	}
+	if err = checkSignedTx(tx, signedTx, s.address, chainId); err != nil {
+		return nil, err
+	}
+	return signedTx, nil
+}
+
+// Close 关闭与外部签名服务的连接
+func (s *ExternalSigner) Close() {
+	s.client.Close()
+}
+
+func newSendTxArgs(from common.Address, tx *types.Transaction, chainId *big.Int) apitypes.SendTxArgs {
+	data := hexutil.Bytes(tx.Data())
+	args := apitypes.SendTxArgs{
+		From:    common.NewMixedcaseAddress(from),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    &data,
+		ChainID: (*hexutil.Big)(chainId),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	default:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	if tx.Type() != types.LegacyTxType {
+		accessList := tx.AccessList()
+		args.AccessList = &accessList
+	}
+	return args
+}
+
+// checkSignedTx 校验外部签名服务返回的交易与请求签名的交易一致
+func checkSignedTx(tx, signedTx *types.Transaction, from common.Address, chainId *big.Int) error {
+	sender, err := types.Sender(types.LatestSignerForChainID(chainId), signedTx)
+	if err != nil {
+		return err
+	}
+	if sender != from {
+		return fmt.Errorf("signed by %s, expected %s", sender.Hex(), from.Hex())
+	}
+	unsigned := types.LatestSignerForChainID(chainId)
+	if unsigned.Hash(tx) != unsigned.Hash(signedTx) {
+		return errors.New("external signer modified the transaction")
+	}
+	return nil
+}
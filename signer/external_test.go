@@ -0,0 +1,157 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01166c2b111"
+
+func newTestExternalSigner(t *testing.T) (*ExternalSigner, *KeySigner) {
+	t.Helper()
+	inner, err := NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewLocalSignerServer(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Stop)
+	external := NewExternalSigner(rpc.DialInProc(server), inner.Address())
+	t.Cleanup(external.Close)
+	return external, inner
+}
+
+func TestExternalSignerRoundTrip(t *testing.T) {
+	external, inner := newTestExternalSigner(t)
+	chainId := big.NewInt(5)
+	to := common.HexToAddress("0x2c3b6a40b8bd3f4b2f6c5ad18fa6ba3bfb8a8e5b")
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+	}{
+		{"dynamic fee", types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainId,
+			Nonce:     7,
+			GasTipCap: big.NewInt(1500000000),
+			GasFeeCap: big.NewInt(30000000000),
+			Gas:       120000,
+			To:        &to,
+			Value:     big.NewInt(1e16),
+			Data:      []byte{0x38, 0xed, 0x17, 0x39, 0x01},
+		})},
+		{"legacy", types.NewTx(&types.LegacyTx{
+			Nonce:    8,
+			GasPrice: big.NewInt(20000000000),
+			Gas:      21000,
+			To:       &to,
+			Value:    big.NewInt(1),
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signedTx, err := external.SignTx(tt.tx, chainId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signedTx.Type() != tt.tx.Type() {
+				t.Fatalf("type = %d, want %d", signedTx.Type(), tt.tx.Type())
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(chainId), signedTx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sender != inner.Address() {
+				t.Fatalf("sender = %s, want %s", sender.Hex(), inner.Address().Hex())
+			}
+			// 签名是确定的，经过签名服务与直接使用本地私钥签名的结果相同
+			want, err := inner.SignTx(tt.tx, chainId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signedTx.Hash() != want.Hash() {
+				t.Fatalf("hash = %s, want %s", signedTx.Hash().Hex(), want.Hash().Hex())
+			}
+		})
+	}
+}
+
+func TestExternalSignerUnknownAccount(t *testing.T) {
+	external, _ := newTestExternalSigner(t)
+	external.address = common.HexToAddress("0x0000000000000000000000000000000000000001")
+	to := common.HexToAddress("0x2c3b6a40b8bd3f4b2f6c5ad18fa6ba3bfb8a8e5b")
+	tx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(1), Gas: 21000, To: &to, Value: big.NewInt(1)})
+	if _, err := external.SignTx(tx, big.NewInt(5)); err == nil {
+		t.Fatal("sign with an account unknown to the signer succeeded")
+	}
+}
+
+func TestDialExternalSignerDefaultAccount(t *testing.T) {
+	inner, err := NewPrivateKeySigner(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewLocalSignerServer(inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	external, err := DialExternalSigner(context.Background(), httpServer.URL, common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer external.Close()
+	if external.Address() != inner.Address() {
+		t.Fatalf("address = %s, want %s", external.Address().Hex(), inner.Address().Hex())
+	}
+}
+
+// stuckSignerApi 一直等待人工确认的签名服务
+type stuckSignerApi struct {
+	release chan struct{}
+}
+
+func (api *stuckSignerApi) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*SignTxResult, error) {
+	select {
+	case <-api.release:
+	case <-ctx.Done():
+	}
+	return nil, errors.New("rejected")
+}
+
+func TestExternalSignerTimeout(t *testing.T) {
+	api := &stuckSignerApi{release: make(chan struct{})}
+	defer close(api.release)
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", api); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	external := NewExternalSigner(rpc.DialInProc(server), common.HexToAddress("0x2c3b6a40b8bd3f4b2f6c5ad18fa6ba3bfb8a8e5b"))
+	defer external.Close()
+	external.Timeout = 50 * time.Millisecond
+
+	tx := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(1), Gas: 21000, Value: big.NewInt(1)})
+	start := time.Now()
+	_, err := external.SignTx(tx, big.NewInt(5))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("SignTx returned after %s", elapsed)
+	}
+}
@@ -0,0 +1,46 @@
+package signer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// NewLocalSignerServer 使用本地 Signer 模拟 clef 签名服务，只实现 account_list 和 account_signTransaction
+// 用于在没有外部签名服务时测试 ExternalSigner，可以通过 rpc.DialInProc 或 http 提供服务
+func NewLocalSignerServer(inner Signer) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &localSignerApi{inner: inner}); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+type localSignerApi struct {
+	inner Signer
+}
+
+func (api *localSignerApi) List(ctx context.Context) ([]common.Address, error) {
+	return []common.Address{api.inner.Address()}, nil
+}
+
+func (api *localSignerApi) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*SignTxResult, error) {
+	if args.From.Address() != api.inner.Address() {
+		return nil, errors.New("unknown account " + args.From.Address().Hex())
+	}
+	if args.ChainID == nil {
+		return nil, errors.New("chainId is required")
+	}
+	signedTx, err := api.inner.SignTx(args.ToTransaction(), args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signedTx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTxResult{Raw: raw, Tx: signedTx}, nil
+}
@@ -0,0 +1,103 @@
+// Package signer 交易签名，支持私钥、geth keystore 以及助记词
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/cosmos/go-bip39"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultDerivationPath 以太坊默认的 bip44 派生路径，即第 0 个账户
+const DefaultDerivationPath = "m/44'/60'/0'/0/0"
+
+// Signer 交易签名
+type Signer interface {
+	// Address 签名账户地址
+	Address() common.Address
+	// SignTx 对未签名交易签名，返回签名后的交易
+	SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error)
+}
+
+// KeySigner 使用本地私钥签名
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+func newKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+	}
+}
+
+// NewPrivateKeySigner 使用 hex 私钥构造 Signer，可以带 0x 前缀
+func NewPrivateKeySigner(privateKeyHex string) (*KeySigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return newKeySigner(key), nil
+}
+
+// NewKeystoreSigner 使用 geth 加密 keystore json 及密码构造 Signer
+func NewKeystoreSigner(keyJson []byte, passphrase string) (*KeySigner, error) {
+	key, err := keystore.DecryptKey(keyJson, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newKeySigner(key.PrivateKey), nil
+}
+
+// NewMnemonicSigner 使用助记词及派生路径构造 Signer，path 为空时使用 DefaultDerivationPath
+func NewMnemonicSigner(mnemonic string, path string) (*KeySigner, error) {
+	if path == "" {
+		path = DefaultDerivationPath
+	}
+	derivationPath, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	key, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range derivationPath {
+		key, err = key.DeriveNonStandard(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	return newKeySigner(privateKey.ToECDSA()), nil
+}
+
+// DerivationPathForIndex 返回第 index 个账户的默认派生路径
+func DerivationPathForIndex(index int) string {
+	return fmt.Sprintf("m/44'/60'/0'/0/%d", index)
+}
+
+func (s *KeySigner) Address() common.Address {
+	return s.address
+}
+
+func (s *KeySigner) SignTx(tx *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainId), s.key)
+}